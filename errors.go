@@ -0,0 +1,158 @@
+package scansion
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrInvalidTarget is returned when the value passed to Scan can't be scanned into
+	ErrInvalidTarget = errors.New("invalid scan target")
+
+	// ErrInvalidTag is returned when the db tag of a field, or one of its options, is malformed
+	ErrInvalidTag = errors.New("invalid db tag")
+
+	// ErrNoPrimaryKey is returned when a struct needs a pk to be merged by, and has none,
+	// or when the result set is missing the pk column of a segment, or the key column of a map
+	ErrNoPrimaryKey = errors.New("no primary key")
+
+	// ErrUnknownColumn is returned for a column with no field in the scan target,
+	// unless unknown columns are ignored or collected by a rest field
+	ErrUnknownColumn = errors.New("unknown column")
+
+	// ErrMalformedColumn is returned for a scan column, or a column path, which can't be parsed
+	ErrMalformedColumn = errors.New("malformed column name")
+
+	// ErrUnfilledField is returned with WithStrictFields, when fields aren't populated by any column
+	ErrUnfilledField = errors.New("fields not populated by any column")
+
+	// ErrInvalidKey is returned for a pk which isn't comparable and doesn't implement Keyer,
+	// or whose Key method returns a value which isn't comparable
+	ErrInvalidKey = errors.New("invalid key")
+
+	// ErrUnorderedRows is returned by Iter and IterBatches when a root reappears after being yielded,
+	// because the rows aren't ordered by the root pk
+	ErrUnorderedRows = errors.New("rows are not ordered by the root pk")
+
+	// ErrTreeCycle is returned when the rows of a tree link back to themselves through their parents
+	ErrTreeCycle = errors.New("tree has a cycle")
+
+	// ErrInvalidVariant is returned when the variants registered for an interface can't be scanned into
+	ErrInvalidVariant = errors.New("invalid variant")
+
+	// ErrUnknownVariant is returned when no variant is registered for the value of a discriminator column
+	ErrUnknownVariant = errors.New("unknown variant")
+)
+
+// ScanError describes an error scanning a particular column.
+// It wraps the underlying error, which is one of the sentinel errors of this package,
+// or the error returned by the driver when the column's value couldn't be scanned.
+type ScanError struct {
+	Err error
+
+	// Used to store the index and name of the column, as returned by the driver
+	ColumnIndex int
+	Column      string
+
+	// Used to store the scoped name of the field the column is scanned into, e.g. "books.title"
+	Field string
+	// Used to store the Go type of the field, if the column has one
+	GoType reflect.Type
+	// Used to store the database type name of the column, if the driver reports it.
+	// It's only looked up for errors scanning a value.
+	DBType string
+
+	// Used to store the number of the row being scanned, starting from 1,
+	// or 0 if the error was found before reading any values
+	Row int
+
+	// Used to store the names of the closest fields, for an unknown column
+	Suggestions []string
+}
+
+func (e *ScanError) Error() string {
+	var b strings.Builder
+	if e.Row > 0 {
+		fmt.Fprintf(&b, "row %d, ", e.Row)
+	}
+	fmt.Fprintf(&b, "column %d %q", e.ColumnIndex, e.Column)
+	if e.DBType != "" {
+		fmt.Fprintf(&b, " (%s)", e.DBType)
+	}
+	if e.Field != "" {
+		fmt.Fprintf(&b, ", field %s", e.Field)
+		if e.GoType != nil {
+			fmt.Fprintf(&b, " (%s)", e.GoType)
+		}
+	}
+	fmt.Fprintf(&b, ": %v", e.Err)
+
+	if len(e.Suggestions) > 0 {
+		quoted := mapFn(e.Suggestions, func(name string) string {
+			return fmt.Sprintf("%q", name)
+		})
+		fmt.Fprintf(&b, ", did you mean %s?", strings.Join(quoted, " or "))
+	}
+
+	return b.String()
+}
+
+func (e *ScanError) Unwrap() error {
+	return e.Err
+}
+
+// maxSuggestions is the most field names suggested for an unknown column
+const maxSuggestions = 3
+
+// suggestFields returns the names of the fields in the segment at path closest to column,
+// closest first. Names too different from column to be a typo aren't suggested.
+func suggestFields(fm *fieldMap, path []string, column string) []string {
+	maxDistance := min(max(2, len(column)/3), len(column)-1)
+
+	distances := make(map[string]int)
+	for _, name := range fm.children[strings.Join(path, ".")] {
+		if distance := editDistance(strings.ToLower(column), strings.ToLower(name)); distance <= maxDistance {
+			distances[name] = distance
+		}
+	}
+
+	suggestions := make([]string, 0, len(distances))
+	for name := range distances {
+		suggestions = append(suggestions, name)
+	}
+	slices.SortFunc(suggestions, func(a, b string) int {
+		if distances[a] != distances[b] {
+			return distances[a] - distances[b]
+		}
+		return strings.Compare(a, b)
+	})
+
+	return suggestions[:min(len(suggestions), maxSuggestions)]
+}
+
+// editDistance returns the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(br)]
+}
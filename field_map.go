@@ -2,11 +2,13 @@ package scansion
 
 import (
 	"database/sql"
-	"errors"
+	"fmt"
 	"maps"
 	"reflect"
 	"slices"
+	"strconv"
 	"strings"
+	"sync"
 )
 
 const (
@@ -14,55 +16,216 @@ const (
 	dbTagIgnore     = "-"
 	dbTagOptionPk   = "pk"
 	dbTagOptionFlat = "flat"
+	// Used as depth=N, to allow a relation's type to repeat down the path up to N times
+	dbTagOptionDepth = "depth"
+	// Used as tree=parent_id, to assemble a slice of the struct's own type
+	// into a tree, by the column holding each row's parent pk
+	dbTagOptionTree = "tree"
+	// Used as key=name, to key a map relation by a column rather than by pk
+	dbTagOptionKey = "key"
+	// Used to map a named nested struct onto columns of its parent's segment
+	dbTagOptionInline = "inline"
+	// Used as prefix=name_, to give the columns of an inline struct a prefix
+	dbTagOptionPrefix = "prefix"
+	// Used as table=name, to name the table a relation's columns come from
+	dbTagOptionTable = "table"
+	// Used on a map[string]any field, to collect the columns of its segment which have no field
+	dbTagOptionRest = "rest"
 
 	scanPrefix = "scan:"
 )
 
+var (
+	anyType     = reflect.TypeOf((*any)(nil)).Elem()
+	keylessType = reflect.TypeOf(Keyless{})
+	restType    = reflect.TypeOf(map[string]any{})
+)
+
+// Keyless can be embedded in a struct without a pk, to mark it as keyless.
+// Each row then appends a new instance of the struct to its slice,
+// rather than being merged into an existing one by pk.
+type Keyless struct{}
+
 type fieldMapEntry struct {
-	Type         reflect.Type
-	ScannedValue reflect.Value
-	StructIdx    []int
-	Optional     bool
-	Flat         bool
+	Type      reflect.Type
+	StructIdx []int
+	Optional  bool
+	Flat      bool
+
+	// Used to store the index path of the field a map relation is keyed by,
+	// within its element struct, and its column name. If nil, the map is keyed by pk.
+	MapKeyIdx    []int
+	MapKeyColumn string
+
+	// Used to store the index path of the field in each variant, for fields of an interface relation,
+	// in which case StructIdx is nil. Variants without the field have no entry.
+	Variants map[reflect.Type][]int
+
+	// Used to store the table given by the table option of a relation
+	Table string
 }
 
+// fieldMap describes how a scan target type maps onto columns.
+// Once built it is shared between scans and must not be modified;
+// per-scan state lives in rowValues.
 type fieldMap struct {
 	Map map[string]fieldMapEntry
 
-	// Used to store the index of the "pk" field for each struct type
-	pkFieldMap map[reflect.Type]int
+	// Used to store the index paths of the "pk" fields for each struct type
+	pkFieldMap map[reflect.Type][][]int
+
+	// Used to store the scoped names of the "pk" fields for each scoped name
+	pkNames map[string][]string
+
+	// Used to store the scoped names of the slices and maps whose elements are merged by pk,
+	// with "" standing for the root, whether it's a slice, map or struct
+	mergedSlices []string
+
+	// Used to store the element types of the slices that aren't merged by pk
+	keylessTypes map[reflect.Type]bool
+
+	// Used to store the ordered children of each scoped name
+	children map[string][]string
+
+	// Used to store the tree field of each struct type assembled into a tree
+	trees map[reflect.Type]treeField
+
+	// Used to store the variants of each interface relation, by scoped name
+	variants map[string]*variantSet
+
+	// Used to store the table of each segment which declares one, by scoped name
+	tables map[string]string
+
+	// Used to store the rest field of each segment which declares one, by scoped name
+	rest map[string]fieldMapEntry
 }
 
-func getFieldMap(v any) (fieldMap, error) {
-	var empty fieldMap
+// rowValues holds the values scanned from a row, keyed by scoped name
+type rowValues map[string]reflect.Value
+
+// fieldMapCache stores a *fieldMap for each fieldMapKey
+var fieldMapCache sync.Map
 
+type fieldMapKey struct {
+	Type           reflect.Type
+	KeylessStructs bool
+}
+
+func getFieldMap(v any, options *scanOptions) (*fieldMap, error) {
 	vType := reflect.TypeOf(v)
-	if vType.Kind() != reflect.Pointer || (vType.Elem().Kind() != reflect.Struct && vType.Elem().Kind() != reflect.Slice) {
-		return empty, errors.New("input is not a struct or slice pointer")
+	cacheKey := fieldMapKey{
+		Type:           vType,
+		KeylessStructs: options.keylessStructs,
+	}
+	if cached, ok := fieldMapCache.Load(cacheKey); ok {
+		return cached.(*fieldMap), nil
+	}
+
+	if vType == nil || vType.Kind() != reflect.Pointer ||
+		(vType.Elem().Kind() != reflect.Struct && vType.Elem().Kind() != reflect.Slice &&
+			vType.Elem().Kind() != reflect.Map) {
+		return nil, fmt.Errorf("%w: %T is not a struct, slice or map pointer", ErrInvalidTarget, v)
+	}
+	if kind := vType.Elem().Kind(); (kind == reflect.Slice || kind == reflect.Map) &&
+		vType.Elem().Elem().Kind() == reflect.Interface {
+		// The root of each row has no segment a discriminator could be read from
+		return nil, fmt.Errorf("%w: %T has interface elements, which are only supported in relations", ErrInvalidTarget, v)
+	}
+	if kind := vType.Elem().Kind(); (kind == reflect.Slice || kind == reflect.Map) &&
+		derefType(vType.Elem().Elem()).Kind() != reflect.Struct {
+		return nil, fmt.Errorf("%w: elements of %T are not structs or struct pointers", ErrInvalidTarget, v)
 	}
 
 	rootMapEntry := fieldMapEntry{
 		Type: vType,
 	}
 
-	fieldMap, err := getFieldMapHelper(vType.Elem(), nil, nil, []reflect.Type{vType}, false)
+	fm, err := getFieldMapHelper(vType.Elem(), nil, nil, []reflect.Type{vType}, false, "")
 	if err != nil {
-		return empty, err
+		return nil, err
 	}
 
-	fieldMap.Map[""] = rootMapEntry
+	fm.Map[""] = rootMapEntry
+	fm.tables = getTables(fm)
 
-	return fieldMap, nil
+	fm.children = make(map[string][]string)
+	for scopedName := range fm.Map {
+		var prefix []string
+		if scopedName != "" {
+			prefix = strings.Split(scopedName, ".")
+		}
+		fm.children[scopedName] = getChildren(fm, prefix)
+	}
+
+	fm.keylessTypes = make(map[reflect.Type]bool)
+	for scopedName, entry := range fm.Map {
+		sliceType := entry.Type
+		if scopedName == "" {
+			sliceType = sliceType.Elem()
+		}
+		if (sliceType.Kind() != reflect.Slice && sliceType.Kind() != reflect.Map) || entry.Flat {
+			continue
+		}
+
+		elemType := derefType(sliceType.Elem())
+		if set, ok := getVariants(elemType); ok {
+			for _, variantType := range set.Types {
+				if variantType = derefType(variantType); isKeyless(variantType, options) {
+					fm.keylessTypes[variantType] = true
+				} else if sliceType.Kind() == reflect.Map {
+					if err := checkMapKey(sliceType, variantType, nil); err != nil {
+						return nil, err
+					}
+				}
+			}
+			if entry.MapKeyIdx == nil {
+				fm.mergedSlices = append(fm.mergedSlices, scopedName)
+			}
+		} else if isKeyless(elemType, options) {
+			if sliceType.Kind() == reflect.Map && entry.MapKeyIdx == nil {
+				return nil, fmt.Errorf("%w: map of keyless %s must be keyed by a column, with the key option", ErrInvalidTag, elemType)
+			}
+			fm.keylessTypes[elemType] = true
+		} else if entry.MapKeyIdx == nil {
+			fm.mergedSlices = append(fm.mergedSlices, scopedName)
+		}
+
+		if sliceType.Kind() == reflect.Map && elemType.Kind() == reflect.Struct &&
+			(entry.MapKeyIdx != nil || !fm.keylessTypes[elemType]) {
+			if err := checkMapKey(sliceType, elemType, entry.MapKeyIdx); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if vType.Elem().Kind() == reflect.Struct && len(fm.pkNames[""]) > 0 {
+		// The rows of a struct root are merged by its pk too, which also tells a second root apart
+		fm.mergedSlices = append(fm.mergedSlices, "")
+	}
+	slices.Sort(fm.mergedSlices)
+
+	cached, _ := fieldMapCache.LoadOrStore(cacheKey, &fm)
+	return cached.(*fieldMap), nil
 }
 
-func getFieldMapHelper(vType reflect.Type, path []string, idxPath []int, visited []reflect.Type, optional bool) (fieldMap, error) {
+func getFieldMapHelper(vType reflect.Type, path []string, idxPath []int, visited []reflect.Type, optional bool, columnPrefix string) (fieldMap, error) {
 	fieldMap := fieldMap{
 		Map:        make(map[string]fieldMapEntry),
-		pkFieldMap: make(map[reflect.Type]int),
+		pkFieldMap: make(map[reflect.Type][][]int),
+		pkNames:    make(map[string][]string),
+		trees:      make(map[reflect.Type]treeField),
+		variants:   make(map[string]*variantSet),
+		rest:       make(map[string]fieldMapEntry),
 	}
 
-	if vType.Kind() == reflect.Slice {
-		vType = vType.Elem()
+	if vType.Kind() == reflect.Slice || vType.Kind() == reflect.Map {
+		vType = derefType(vType.Elem())
+	}
+
+	var treeFieldIdx int
+	var treeParentColumn string
+
+	if pkIdxs, err := getPkFieldIdxs(vType); err == nil {
+		fieldMap.pkFieldMap[vType] = pkIdxs
 	}
 
 	for i := range vType.NumField() {
@@ -80,34 +243,138 @@ func getFieldMapHelper(vType reflect.Type, path []string, idxPath []int, visited
 			dbFieldName = dbTagParts[0]
 			extraOptions = dbTagParts[1:]
 		}
+		dbFieldName = columnPrefix + dbFieldName
+
+		if slices.Contains(extraOptions, dbTagOptionRest) {
+			if structField.Type != restType {
+				return fieldMap, fmt.Errorf("%w: rest field %s must be a map[string]any", ErrInvalidTag, structField.Name)
+			}
+			segmentName := strings.Join(path, ".")
+			if _, ok := fieldMap.rest[segmentName]; ok {
+				return fieldMap, fmt.Errorf("%w: %s has more than one rest field", ErrInvalidTag, vType)
+			}
+
+			// The columns are only known once scanning, so the field has no column of its own
+			fieldMap.rest[segmentName] = fieldMapEntry{
+				Type:      structField.Type,
+				StructIdx: appendIdx(idxPath, i),
+			}
+			continue
+		}
+
+		maxDepth := 1
+		if depthOption, ok := getTagOption(extraOptions, dbTagOptionDepth); ok {
+			var err error
+			if maxDepth, err = strconv.Atoi(depthOption); err != nil || maxDepth < 1 {
+				return fieldMap, fmt.Errorf("%w: depth %q of field %s must be a positive integer", ErrInvalidTag, depthOption, structField.Name)
+			}
+		}
+
+		if parentColumn, ok := getTagOption(extraOptions, dbTagOptionTree); ok {
+			if structField.Type.Kind() != reflect.Slice || derefType(structField.Type.Elem()) != vType {
+				return fieldMap, fmt.Errorf("%w: tree field %s must be a slice of %s", ErrInvalidTag, structField.Name, vType)
+			}
+			if treeParentColumn != "" {
+				return fieldMap, fmt.Errorf("%w: %s has more than one tree field", ErrInvalidTag, vType)
+			}
+
+			// The children are linked after scanning, so the field isn't scanned into
+			treeFieldIdx = i
+			treeParentColumn = columnPrefix + parentColumn
+			continue
+		}
 
-		scannable := structField.Type.Implements(reflect.TypeOf(new(sql.Scanner)).Elem())
+		// Types like sql.NullString and pgtype.UUID implement sql.Scanner on their pointer
+		scannerType := reflect.TypeOf(new(sql.Scanner)).Elem()
+		scannable := structField.Type.Implements(scannerType) ||
+			reflect.PointerTo(structField.Type).Implements(scannerType)
+		isRelationCollection := (structField.Type.Kind() == reflect.Slice || structField.Type.Kind() == reflect.Map) &&
+			isRelationType(structField.Type.Elem())
 		isFlat := slices.Contains(extraOptions, dbTagOptionFlat) ||
-			(structField.Type.Kind() == reflect.Slice && structField.Type.Elem().Kind() != reflect.Struct)
+			(structField.Type.Kind() == reflect.Slice && !isRelationCollection)
 		canRecurse := !scannable && !isFlat && !isBuiltinStruct(structField.Type)
 
+		keyColumn, hasKeyColumn := getTagOption(extraOptions, dbTagOptionKey)
+		if hasKeyColumn && (structField.Type.Kind() != reflect.Map || !canRecurse) {
+			return fieldMap, fmt.Errorf("%w: key option on field %s requires a map of structs", ErrInvalidTag, structField.Name)
+		}
+		var mapKeyIdx []int
+
+		isStructOrPointer := derefType(structField.Type).Kind() == reflect.Struct
+		isInline := slices.Contains(extraOptions, dbTagOptionInline)
+		if isInline && (!canRecurse || !isStructOrPointer) {
+			return fieldMap, fmt.Errorf("%w: inline option on field %s requires a struct or struct pointer", ErrInvalidTag, structField.Name)
+		}
+
 		if canRecurse {
-			if structField.Type.Kind() == reflect.Slice {
-				visitedType := structField.Type.Elem()
-				if slices.Contains(path, dbFieldName) || slices.Contains(visited, visitedType) {
-					continue
+			if (structField.Anonymous || isInline) && isStructOrPointer {
+				// Embedded or inline struct, or struct pointer
+				visitedType := derefType(structField.Type)
+				// Each embedded or inline struct adds one index to idxPath and its type to visited,
+				// so the types this one is nested in since the last relation end visited
+				if visitedType == vType || slices.Contains(visited[len(visited)-len(idxPath):], visitedType) {
+					return fieldMap, fmt.Errorf("%w: field %s of %s contains %s within itself", ErrInvalidTag, structField.Name, vType, visitedType)
+				}
+
+				nestedPrefix := columnPrefix
+				if isInline {
+					prefixOption, _ := getTagOption(extraOptions, dbTagOptionPrefix)
+					nestedPrefix += prefixOption
 				}
 
 				nestedMap, err := getFieldMapHelper(
 					visitedType,
-					append(path, dbFieldName),
-					nil,
+					path,
+					appendIdx(idxPath, i),
 					append(visited, visitedType),
-					true)
+					optional || structField.Type.Kind() == reflect.Pointer,
+					nestedPrefix)
+				if err != nil {
+					return fieldMap, err
+				}
+				if isInline {
+					// Only embedded structs contribute to the pk of their parent
+					delete(nestedMap.pkNames, strings.Join(path, "."))
+				}
+				fieldMap.merge(nestedMap)
+
+				// Since this is an embedded or inline struct, we should NOT create an entry in the fieldMap for it
+				continue
+			} else if isRelationCollection {
+				visitedType := derefType(structField.Type.Elem())
+
+				if !canVisit(path, visited, dbFieldName, visitedType, maxDepth) {
+					continue
+				}
+
+				nestedMap, err := getRelationFieldMap(visitedType, append(path, dbFieldName), visited)
 				if err != nil {
 					return fieldMap, err
 				}
-				maps.Copy(fieldMap.Map, nestedMap.Map)
+				fieldMap.merge(nestedMap)
+
+				if hasKeyColumn {
+					keyEntry, ok := nestedMap.Map[strings.Join(append(path, dbFieldName, keyColumn), ".")]
+					if !ok || keyEntry.Variants != nil {
+						return fieldMap, fmt.Errorf("%w: map field %s refers to unknown key column %s", ErrInvalidTag, structField.Name, keyColumn)
+					}
+					mapKeyIdx = keyEntry.StructIdx
+				}
+			} else if set, ok := getVariants(structField.Type); ok {
+				if !canVisit(path, visited, dbFieldName, structField.Type, maxDepth) {
+					continue
+				}
+
+				nestedMap, err := getVariantsFieldMap(set, append(path, dbFieldName), visited)
+				if err != nil {
+					return fieldMap, err
+				}
+				fieldMap.merge(nestedMap)
 			} else if structField.Type.Kind() == reflect.Pointer &&
 				structField.Type.Elem().Kind() == reflect.Struct {
 				visitedType := structField.Type.Elem()
 
-				if slices.Contains(path, dbFieldName) || slices.Contains(visited, visitedType) {
+				if !canVisit(path, visited, dbFieldName, visitedType, maxDepth) {
 					continue
 				}
 
@@ -116,32 +383,16 @@ func getFieldMapHelper(vType reflect.Type, path []string, idxPath []int, visited
 					append(path, dbFieldName),
 					nil,
 					append(visited, visitedType),
-					true)
-				if err != nil {
-					return fieldMap, err
-				}
-				maps.Copy(fieldMap.Map, nestedMap.Map)
-			} else if structField.Type.Kind() == reflect.Struct && structField.Anonymous {
-				// Embedded struct
-				visitedType := structField.Type
-
-				nestedMap, err := getFieldMapHelper(
-					visitedType,
-					path,
-					[]int{i},
-					visited,
-					false)
+					true,
+					"")
 				if err != nil {
 					return fieldMap, err
 				}
-				maps.Copy(fieldMap.Map, nestedMap.Map)
-
-				// Since this is an embedded struct, we should NOT create an entry in the fieldMap for it
-				continue
+				fieldMap.merge(nestedMap)
 			} else if structField.Type.Kind() == reflect.Struct {
 				visitedType := structField.Type
 
-				if slices.Contains(path, dbFieldName) || slices.Contains(visited, visitedType) {
+				if !canVisit(path, visited, dbFieldName, visitedType, maxDepth) {
 					continue
 				}
 
@@ -150,63 +401,270 @@ func getFieldMapHelper(vType reflect.Type, path []string, idxPath []int, visited
 					append(path, dbFieldName),
 					nil,
 					append(visited, visitedType),
-					false)
+					false,
+					"")
 				if err != nil {
 					return fieldMap, err
 				}
-				maps.Copy(fieldMap.Map, nestedMap.Map)
+				fieldMap.merge(nestedMap)
 			}
 		}
 
 		scopedName := strings.Join(append(path, dbFieldName), ".")
+		if slices.Contains(extraOptions, dbTagOptionPk) {
+			parentName := strings.Join(path, ".")
+			fieldMap.pkNames[parentName] = append(fieldMap.pkNames[parentName], scopedName)
+		}
+
 		fieldMap.Map[scopedName] = fieldMapEntry{
-			Type:      structField.Type,
-			StructIdx: append(idxPath, i),
-			Optional:  optional,
-			Flat:      !canRecurse,
+			Type:         structField.Type,
+			StructIdx:    appendIdx(idxPath, i),
+			Optional:     optional,
+			Flat:         !canRecurse,
+			MapKeyIdx:    mapKeyIdx,
+			MapKeyColumn: keyColumn,
+		}
+		if table, ok := getTagOption(extraOptions, dbTagOptionTable); ok {
+			if !canRecurse {
+				return fieldMap, fmt.Errorf("%w: table option on field %s requires a relation", ErrInvalidTag, structField.Name)
+			}
+			entry := fieldMap.Map[scopedName]
+			entry.Table = table
+			fieldMap.Map[scopedName] = entry
+		}
+	}
+
+	if treeParentColumn != "" {
+		tree, err := newTreeField(fieldMap, vType, path, idxPath, treeFieldIdx, treeParentColumn)
+		if err != nil {
+			return fieldMap, err
 		}
+		fieldMap.trees[vType] = tree
 	}
 
 	return fieldMap, nil
 }
 
-func (f *fieldMap) getPkValue(v reflect.Value) (reflect.Value, error) {
-	var pkValue reflect.Value
+// checkMapKey ensures the elements of type elemType in a map of mapType can be keyed
+// by the field at keyIdx, or by their pk if keyIdx is nil.
+// Keys are never converted, since that could silently change them, e.g. from an int to a rune string.
+func checkMapKey(mapType, elemType reflect.Type, keyIdx []int) error {
+	if keyIdx == nil {
+		pkIdxs, err := getPkFieldIdxs(elemType)
+		if err != nil {
+			return err
+		}
+		if len(pkIdxs) != 1 {
+			return fmt.Errorf("%w: map of %s can't be keyed by a composite pk", ErrInvalidTag, elemType)
+		}
+		keyIdx = pkIdxs[0]
+	}
+
+	keyType := elemType.FieldByIndex(keyIdx).Type
+	if !isAssignableKey(keyType, mapType.Key()) {
+		return fmt.Errorf("%w: key of type %s can't be used as a key of %s", ErrInvalidTag, keyType, mapType)
+	}
+
+	return nil
+}
+
+// isAssignableKey reports whether a field of keyType can be used as a map key of mapKeyType,
+// either as it is or by dereferencing it
+func isAssignableKey(keyType, mapKeyType reflect.Type) bool {
+	return keyType.AssignableTo(mapKeyType) ||
+		(keyType.Kind() == reflect.Pointer && keyType.Elem().AssignableTo(mapKeyType))
+}
+
+// merge adds the entries of nested, the field map of an embedded struct or a relation, to f.
+// An embedded struct's pk names are stored under its parent's scoped name, so they're added to the parent's.
+func (f *fieldMap) merge(nested fieldMap) {
+	maps.Copy(f.Map, nested.Map)
+	maps.Copy(f.pkFieldMap, nested.pkFieldMap)
+	f.mergePkNames(nested.pkNames)
+	maps.Copy(f.trees, nested.trees)
+	maps.Copy(f.variants, nested.variants)
+	maps.Copy(f.rest, nested.rest)
+}
+
+// mergePkNames adds pkNames to the pk names of f, skipping those it already has
+func (f *fieldMap) mergePkNames(pkNames map[string][]string) {
+	for scopedName, names := range pkNames {
+		for _, pkName := range names {
+			if !slices.Contains(f.pkNames[scopedName], pkName) {
+				f.pkNames[scopedName] = append(f.pkNames[scopedName], pkName)
+			}
+		}
+	}
+}
+
+// getRelationFieldMap builds the field map of a slice or map relation's element type
+func getRelationFieldMap(vType reflect.Type, path []string, visited []reflect.Type) (fieldMap, error) {
+	if set, ok := getVariants(vType); ok {
+		return getVariantsFieldMap(set, path, visited)
+	}
+
+	return getFieldMapHelper(vType, path, nil, append(visited, vType), true, "")
+}
+
+func isKeyless(vType reflect.Type, options *scanOptions) bool {
+	for i := range vType.NumField() {
+		if structField := vType.Field(i); structField.Anonymous && structField.Type == keylessType {
+			return true
+		}
+	}
 
+	if options.keylessStructs {
+		_, err := getPkFieldIdxs(vType)
+		return err != nil
+	}
+
+	return false
+}
+
+// canVisit reports whether a relation can be followed, without its name
+// or type repeating down the path more than maxDepth times
+func canVisit(path []string, visited []reflect.Type, name string, vType reflect.Type, maxDepth int) bool {
+	return countOf(path, name) < maxDepth && countOf(visited, vType) < maxDepth
+}
+
+// getTagOption returns the value of a key=value option
+func getTagOption(options []string, key string) (string, bool) {
+	for _, option := range options {
+		if value, ok := strings.CutPrefix(option, key+"="); ok {
+			return value, true
+		}
+	}
+
+	return "", false
+}
+
+// getPkValues returns the values of the "pk" fields of v.
+// More than one value means v has a composite pk.
+func (f *fieldMap) getPkValues(v reflect.Value) ([]reflect.Value, error) {
+	if v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
 	if v.Kind() == reflect.Pointer {
 		v = v.Elem()
 	}
 
 	if v.Kind() != reflect.Struct {
-		return reflect.Value{}, errors.New("input must be of type struct")
+		return nil, fmt.Errorf("%w: %s is not a struct", ErrInvalidTarget, v.Kind())
+	}
+
+	fieldIdxs, ok := f.pkFieldMap[v.Type()]
+	if !ok {
+		var err error
+		if fieldIdxs, err = getPkFieldIdxs(v.Type()); err != nil {
+			return nil, err
+		}
+	}
+
+	pkValues := make([]reflect.Value, len(fieldIdxs))
+	for i, fieldIdx := range fieldIdxs {
+		pkValue, err := v.FieldByIndexErr(fieldIdx)
+		if err != nil {
+			// The pk is inside a nil embedded struct pointer
+			pkValue = reflect.Zero(v.Type().FieldByIndex(fieldIdx).Type)
+		}
+		pkValues[i] = pkValue
+	}
+
+	return pkValues, nil
+}
+
+// getPkKey returns a comparable key identifying v by its pk,
+// which can be used as a map key
+func (f *fieldMap) getPkKey(v reflect.Value) (any, error) {
+	pkValues, err := f.getPkValues(v)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := pkKey(pkValues)
+	if err != nil {
+		return nil, err
+	}
+
+	// Variants of an interface can share pk values, so they're told apart by type
+	if v.Kind() == reflect.Interface {
+		return identityKey{Type: v.Elem().Type(), Pk: key}, nil
+	}
+
+	return key, nil
+}
+
+// getRowPkKey returns the same key as getPkKey, for the struct at scopedName,
+// but computed from the values of a row before they're built into a result.
+// If the struct has no pk, ok is false.
+func (f *fieldMap) getRowPkKey(values rowValues, scopedName string) (key any, ok bool, err error) {
+	pkNames, ok := f.pkNames[scopedName]
+	if !ok {
+		return nil, false, nil
+	}
+
+	pkValues := make([]reflect.Value, len(pkNames))
+	for i, pkName := range pkNames {
+		pkValue, ok := values[pkName]
+		if !ok {
+			pkValue = reflect.Zero(f.Map[pkName].Type)
+		}
+		pkValues[i] = pkValue
+	}
+
+	key, err = pkKey(pkValues)
+	if err != nil {
+		return nil, false, err
 	}
 
-	if fieldIdx, ok := f.pkFieldMap[v.Type()]; ok {
-		return v.Field(fieldIdx), nil
+	return key, true, nil
+}
+
+// getPkFieldIdxs returns the index paths of the "pk" fields of vType,
+// including those of embedded structs and struct pointers
+func getPkFieldIdxs(vType reflect.Type) ([][]int, error) {
+	pkIdxs := getPkFieldIdxsHelper(vType, nil, nil)
+	if len(pkIdxs) == 0 {
+		return nil, fmt.Errorf("%w: at least one field of %s must have 'pk' set", ErrNoPrimaryKey, vType)
 	}
 
-	for i := range v.NumField() {
-		fieldType := v.Type().Field(i)
-		fieldVal := v.Field(i)
-		fullDbTag := fieldType.Tag.Get(dbTagName)
+	return pkIdxs, nil
+}
+
+func getPkFieldIdxsHelper(vType reflect.Type, idxPath []int, visited []reflect.Type) [][]int {
+	var pkIdxs [][]int
+
+	for i := range vType.NumField() {
+		structField := vType.Field(i)
+		fullDbTag := structField.Tag.Get(dbTagName)
+		if fullDbTag == dbTagIgnore {
+			continue
+		}
+
+		if structField.Anonymous {
+			embeddedType := structField.Type
+			if embeddedType.Kind() == reflect.Pointer {
+				embeddedType = embeddedType.Elem()
+			}
+			if embeddedType.Kind() == reflect.Struct && !slices.Contains(visited, embeddedType) {
+				pkIdxs = append(pkIdxs, getPkFieldIdxsHelper(
+					embeddedType,
+					appendIdx(idxPath, i),
+					append(visited, vType))...)
+				continue
+			}
+		}
+
 		if fullDbTag == "" {
 			continue
 		}
 		dbTagParts := strings.Split(fullDbTag, ",")
 		dbTagParts = mapFn(dbTagParts, strings.TrimSpace)
 
-		if len(dbTagParts) == 2 && dbTagParts[1] == dbTagOptionPk {
-			if pkValue.IsValid() {
-				return reflect.Value{}, errors.New("exactly one column must have 'pk' set")
-			}
-			pkValue = fieldVal
-			f.pkFieldMap[v.Type()] = i
+		if slices.Contains(dbTagParts[1:], dbTagOptionPk) {
+			pkIdxs = append(pkIdxs, appendIdx(idxPath, i))
 		}
 	}
 
-	if !pkValue.IsValid() {
-		return reflect.Value{}, errors.New("exactly one column must have 'pk' set")
-	}
-
-	return pkValue, nil
+	return pkIdxs
 }
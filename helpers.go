@@ -14,6 +14,53 @@ func mapFn[T any, U any](s []T, fn func(T) U) []U {
 	return result
 }
 
+// appendIdx appends to a copy of idxPath, so index paths never share a backing array
+func appendIdx(idxPath []int, idx int) []int {
+	return append(idxPath[:len(idxPath):len(idxPath)], idx)
+}
+
+// fieldByIndexAlloc is like reflect.Value.FieldByIndex,
+// but allocates any nil struct pointers along the way, including v itself
+func fieldByIndexAlloc(v reflect.Value, index []int) reflect.Value {
+	for _, x := range index {
+		if v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+
+	return v
+}
+
+// derefType returns the type typ points to, or typ itself if it isn't a pointer
+func derefType(typ reflect.Type) reflect.Type {
+	if typ.Kind() == reflect.Pointer {
+		return typ.Elem()
+	}
+	return typ
+}
+
+// structTypeOf returns the struct type of v, looking through interfaces and pointers
+func structTypeOf(v reflect.Value) reflect.Type {
+	if v.Kind() == reflect.Interface && !v.IsNil() {
+		v = v.Elem()
+	}
+	return derefType(v.Type())
+}
+
+func countOf[T comparable](s []T, v T) int {
+	var count int
+	for _, elem := range s {
+		if elem == v {
+			count++
+		}
+	}
+	return count
+}
+
 func hasPrefix[T comparable](s []T, p []T) bool {
 	if len(p) == 0 {
 		return true
@@ -38,9 +85,12 @@ func getChildren(fm fieldMap, prefix []string) []string {
 		if k == "" {
 			continue
 		}
-		vType := v.Type
-		if vType.Kind() == reflect.Pointer || vType.Kind() == reflect.Slice {
-			vType = vType.Elem()
+		vType := derefType(v.Type)
+		if vType.Kind() == reflect.Slice || vType.Kind() == reflect.Map {
+			vType = derefType(vType.Elem())
+		}
+		if _, ok := fm.variants[k]; ok {
+			vType = reflect.TypeFor[struct{}]()
 		}
 
 		keyParts := strings.Split(k, ".")
@@ -0,0 +1,119 @@
+package scansion
+
+import (
+	"reflect"
+)
+
+type identityKey struct {
+	Type reflect.Type
+	Pk   any
+}
+
+type identityEntry struct {
+	ptr reflect.Value
+
+	// Used to store the indexes of the slices nested in the shared instance
+	index mergeIndex
+}
+
+// identityMap stores the shared instance of each entity referenced by a struct pointer,
+// so every occurrence of the same type and pk resolves to the same pointer
+type identityMap map[identityKey]*identityEntry
+
+// resolve replaces every struct pointer in v which has a pk with its shared instance,
+// first merging any new values into it
+func (m identityMap) resolve(fieldMap *fieldMap, v reflect.Value) error {
+	return m.resolveHelper(fieldMap, v, make(map[uintptr]bool))
+}
+
+func (m identityMap) resolveHelper(fieldMap *fieldMap, v reflect.Value, seen map[uintptr]bool) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Elem().Kind() != reflect.Struct || seen[v.Pointer()] {
+			return nil
+		}
+		seen[v.Pointer()] = true
+
+		// Resolve the pointer's own relations first, so they're shared when merged
+		if err := m.resolveHelper(fieldMap, v.Elem(), seen); err != nil {
+			return err
+		}
+
+		if _, ok := fieldMap.pkFieldMap[v.Type().Elem()]; !ok || !v.CanSet() {
+			return nil
+		}
+
+		pk, err := fieldMap.getPkKey(v)
+		if err != nil {
+			return err
+		}
+
+		key := identityKey{Type: v.Type().Elem(), Pk: pk}
+		entry, ok := m[key]
+		if !ok {
+			m[key] = &identityEntry{
+				// Copied out of the field, which may be overwritten later
+				ptr:   v.Elem().Addr(),
+				index: make(mergeIndex),
+			}
+			return nil
+		}
+
+		if entry.ptr.Pointer() != v.Pointer() {
+			if err := structMerge(fieldMap, entry.index, "", entry.ptr.Elem(), v.Elem()); err != nil {
+				return err
+			}
+			v.Set(entry.ptr)
+		}
+	case reflect.Slice:
+		if elemKind := v.Type().Elem().Kind(); elemKind != reflect.Struct && elemKind != reflect.Pointer {
+			return nil
+		}
+
+		for i := range v.Len() {
+			if err := m.resolveHelper(fieldMap, v.Index(i), seen); err != nil {
+				return err
+			}
+		}
+	case reflect.Interface:
+		if v.IsNil() || !v.CanSet() {
+			return nil
+		}
+
+		// Values held by an interface aren't addressable, so they're resolved on a copy
+		elem := reflect.New(v.Elem().Type()).Elem()
+		elem.Set(v.Elem())
+		if err := m.resolveHelper(fieldMap, elem, seen); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Map:
+		if derefType(v.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+
+		// Map elements aren't addressable, so they're resolved on a copy
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := m.resolveHelper(fieldMap, elem, seen); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		if isBuiltinStruct(v.Type()) {
+			return nil
+		}
+
+		for i := range v.NumField() {
+			if field := v.Field(i); field.CanSet() {
+				if err := m.resolveHelper(fieldMap, field, seen); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
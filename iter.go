@@ -0,0 +1,138 @@
+package scansion
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"reflect"
+)
+
+// Iter returns an iterator over the root entities in the Scanner's rows,
+// yielding each one as soon as it has been fully assembled.
+// The rows must be ordered by the root pk, so that all the rows of a root
+// are adjacent. Only the roots not yielded yet are kept, so a root which reappears
+// after being yielded is yielded again, unless the Scanner was created with WithStrictOrder.
+// The rows are closed once iteration stops.
+func Iter[T any](s Scanner) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		for batch, err := range IterBatches[T](s, 1) {
+			if err != nil {
+				var zero T
+				yield(zero, err)
+				return
+			}
+
+			if !yield(batch[0], nil) {
+				return
+			}
+		}
+	}
+}
+
+// IterBatches is like Iter, but yields the root entities in batches of up to size,
+// so that at most one batch is held in memory at a time.
+func IterBatches[T any](s Scanner, size int) iter.Seq2[[]T, error] {
+	return func(yield func([]T, error) bool) {
+		rs, ok := s.(rowScanner)
+		if !ok {
+			yield(nil, fmt.Errorf("%w: %T does not support iteration", ErrInvalidTarget, s))
+			return
+		}
+		defer rs.closeRows()
+
+		if size < 1 {
+			yield(nil, fmt.Errorf("%w: batch size must be at least 1, got %d", ErrInvalidTarget, size))
+			return
+		}
+
+		var batch []T
+		fieldMap, err := getFieldMap(&batch, rs.scanOptions())
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+
+		// A tree's rows can arrive in any order, so its roots are only known once every row is read
+		if _, ok := fieldMap.trees[derefType(reflect.TypeFor[T]())]; ok {
+			yield(nil, fmt.Errorf("%w: trees can't be iterated, since their roots are only known after the last row", ErrInvalidTarget))
+			return
+		}
+
+		reader := newRowReader(rs, fieldMap)
+		index := make(mergeIndex)
+		identities := rs.scanOptions().newIdentityMap()
+		// Used to store the pk of every root seen so far, to detect unordered rows with WithStrictOrder
+		var seen map[any]struct{}
+		if rs.scanOptions().strictOrder {
+			seen = make(map[any]struct{})
+		}
+		for {
+			ok, err := reader.next(context.Background())
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			if !ok {
+				break
+			}
+
+			prevLen := len(batch)
+			if err := buildResult(&batch, fieldMap, reader.values, index, identities); err != nil {
+				yield(nil, err)
+				return
+			}
+			if len(batch) == prevLen {
+				// Merged into a root that hasn't been yielded yet
+				continue
+			}
+
+			// Keyless roots can't reappear, since every row appends a new one
+			if seen != nil && !fieldMap.keylessTypes[derefType(reflect.TypeFor[T]())] {
+				rootPk, err := fieldMap.getPkKey(reflect.ValueOf(batch).Index(len(batch) - 1))
+				if err != nil {
+					yield(nil, err)
+					return
+				}
+				if _, ok := seen[rootPk]; ok {
+					yield(nil, fmt.Errorf("%w: root with pk %v reappeared after being yielded", ErrUnorderedRows, rootPk))
+					return
+				}
+				seen[rootPk] = struct{}{}
+			}
+
+			// A new root means every root before it is complete
+			if len(batch) > size {
+				next := make([]T, 1, size+1)
+				next[0] = batch[size]
+				if err := assembleBatchTrees(fieldMap, batch[:size:size]); err != nil {
+					yield(nil, err)
+					return
+				}
+				if !yield(batch[:size:size], nil) {
+					return
+				}
+
+				batch = next
+				index = make(mergeIndex)
+				identities = rs.scanOptions().newIdentityMap()
+			}
+		}
+
+		if len(batch) > 0 {
+			if err := assembleBatchTrees(fieldMap, batch); err != nil {
+				yield(nil, err)
+				return
+			}
+			yield(batch, nil)
+		}
+	}
+}
+
+// assembleBatchTrees assembles the trees nested in the roots of a batch
+func assembleBatchTrees[T any](fieldMap *fieldMap, batch []T) error {
+	if len(fieldMap.trees) == 0 {
+		return nil
+	}
+
+	return fieldMap.assembleTrees(reflect.ValueOf(batch))
+}
@@ -0,0 +1,141 @@
+package scansion
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"time"
+)
+
+// Keyer can be implemented by a pk type to provide the value it's identified by.
+// Key must return a comparable value. This is useful for pk types which aren't
+// comparable, or which contain pointers and so aren't equal when their values are.
+type Keyer interface {
+	Key() any
+}
+
+var (
+	keyerType  = reflect.TypeOf((*Keyer)(nil)).Elem()
+	valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+	timeType   = reflect.TypeOf(time.Time{})
+)
+
+// pkKey returns a comparable key for the values of a pk,
+// which can be used as a map key
+func pkKey(pkValues []reflect.Value) (any, error) {
+	if len(pkValues) == 1 {
+		return normalizeKey(pkValues[0])
+	}
+
+	// Composite pks are keyed by an array of their values, which is comparable
+	key := reflect.New(reflect.ArrayOf(len(pkValues), anyType)).Elem()
+	for i, pkValue := range pkValues {
+		keyPart, err := normalizeKey(pkValue)
+		if err != nil {
+			return nil, err
+		}
+		if keyPart != nil {
+			key.Index(i).Set(reflect.ValueOf(keyPart))
+		}
+	}
+
+	return key.Interface(), nil
+}
+
+// normalizeKey converts a pk value into a comparable value,
+// such that equal pk values always have equal keys
+func normalizeKey(v reflect.Value) (any, error) {
+	if !v.IsValid() {
+		return nil, nil
+	}
+
+	if (v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface) && v.IsNil() {
+		return nil, nil
+	}
+
+	if keyer, ok := asInterface(v, keyerType); ok {
+		key := keyer.(Keyer).Key()
+		if key != nil && !reflect.ValueOf(key).Comparable() {
+			return nil, fmt.Errorf("%w: key of type %T returned by %s is not comparable", ErrInvalidKey, key, v.Type())
+		}
+		return key, nil
+	}
+
+	if v.Type() == timeType {
+		return normalizeTime(v.Interface().(time.Time)), nil
+	}
+
+	// Covers sql.Null* and pgtype types, which all have a driver.Value
+	if valuer, ok := asInterface(v, valuerType); ok {
+		driverValue, err := valuer.(driver.Valuer).Value()
+		if err != nil {
+			return nil, err
+		}
+
+		switch driverValue := driverValue.(type) {
+		case []byte:
+			return string(driverValue), nil
+		case time.Time:
+			return normalizeTime(driverValue), nil
+		default:
+			return driverValue, nil
+		}
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		return normalizeKey(v.Elem())
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return string(v.Bytes()), nil
+		}
+		return normalizeSequence(v)
+	case reflect.Array:
+		if v.Type().Comparable() {
+			return v.Interface(), nil
+		}
+		return normalizeSequence(v)
+	}
+
+	if !v.Comparable() {
+		return nil, fmt.Errorf("%w: pk of type %s is not comparable, and does not implement Keyer", ErrInvalidKey, v.Type())
+	}
+
+	return v.Interface(), nil
+}
+
+// normalizeSequence converts the elements of a slice or array
+// into an array of their keys, which is comparable
+func normalizeSequence(v reflect.Value) (any, error) {
+	key := reflect.New(reflect.ArrayOf(v.Len(), anyType)).Elem()
+	for i := range v.Len() {
+		elemKey, err := normalizeKey(v.Index(i))
+		if err != nil {
+			return nil, err
+		}
+		if elemKey != nil {
+			key.Index(i).Set(reflect.ValueOf(elemKey))
+		}
+	}
+
+	return key.Interface(), nil
+}
+
+// normalizeTime strips the location and monotonic clock reading from t,
+// so equal instants are equal keys
+func normalizeTime(t time.Time) time.Time {
+	return t.Round(0).UTC()
+}
+
+// asInterface returns v, or a pointer to it, as iface if either implements it
+func asInterface(v reflect.Value, iface reflect.Type) (any, bool) {
+	if v.Type().Implements(iface) {
+		return v.Interface(), true
+	}
+
+	if v.CanAddr() && v.Addr().Type().Implements(iface) {
+		return v.Addr().Interface(), true
+	}
+
+	return nil, false
+}
@@ -0,0 +1,120 @@
+package scansion
+
+// Option configures how a Scanner scans its rows
+type Option func(*scanOptions)
+
+// UnknownColumnPolicy decides what happens to a column with no field in the scan target
+type UnknownColumnPolicy int
+
+const (
+	// UnknownColumnsError fails the scan, which is the default
+	UnknownColumnsError UnknownColumnPolicy = iota
+	// UnknownColumnsIgnore skips the column
+	UnknownColumnsIgnore
+	// UnknownColumnsRest collects the column in the closest rest field, of its own segment or an ancestor's,
+	// and fails the scan if there's none
+	UnknownColumnsRest
+)
+
+type scanOptions struct {
+	keylessStructs bool
+	identityMap    bool
+
+	// Used to store the prefix of the column names which mark a segment boundary
+	scanPrefix string
+
+	// Used to store the separator of the path in a column name, if enabled
+	pathSeparator string
+
+	// Used to look up the table names of columns, if segments are inferred from them
+	tableQuerier PgxQuerier
+	tableNames   *tableNames
+
+	unknownColumns UnknownColumnPolicy
+	strictFields   bool
+	strictOrder    bool
+}
+
+func newScanOptions(opts []Option) scanOptions {
+	options := scanOptions{
+		scanPrefix: scanPrefix,
+	}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	return options
+}
+
+// WithKeylessStructs treats every struct without a pk as if it embedded Keyless,
+// so each row appends a new instance of it instead of failing to merge.
+func WithKeylessStructs() Option {
+	return func(o *scanOptions) {
+		o.keylessStructs = true
+	}
+}
+
+// WithIdentityMap makes every struct pointer to the same type and pk resolve to one shared instance,
+// so later rows enrich that instance wherever it's referenced.
+// This applies to *T fields and their nested relations, and only across the roots of one scan,
+// or of one batch with IterBatches.
+func WithIdentityMap() Option {
+	return func(o *scanOptions) {
+		o.identityMap = true
+	}
+}
+
+// WithScanPrefix replaces the "scan:" prefix of the columns which mark a segment boundary.
+// An empty prefix is ignored.
+func WithScanPrefix(prefix string) Option {
+	return func(o *scanOptions) {
+		if prefix != "" {
+			o.scanPrefix = prefix
+		}
+	}
+}
+
+// WithPathSeparator enables column names which contain the path of their field,
+// split by separator, e.g. "books.title" or "books__title" for the title of each of the root's books.
+// Such columns are routed straight to their field, so the query needs no scan columns for them,
+// and they can be mixed with scan columns.
+// Their path always starts at the root, whatever segment the columns before them are in.
+func WithPathSeparator(separator string) Option {
+	return func(o *scanOptions) {
+		o.pathSeparator = separator
+	}
+}
+
+// WithUnknownColumns sets what happens to columns with no field in the scan target
+func WithUnknownColumns(policy UnknownColumnPolicy) Option {
+	return func(o *scanOptions) {
+		o.unknownColumns = policy
+	}
+}
+
+// WithStrictFields fails the scan if any field of the scan target isn't populated by a column,
+// listing every such field. Fields of relations which are cut off by their depth aren't included.
+// This catches mistakes like a forgotten join, at the cost of selecting every field of every relation.
+func WithStrictFields() Option {
+	return func(o *scanOptions) {
+		o.strictFields = true
+	}
+}
+
+// WithStrictOrder makes Iter and IterBatches fail with ErrUnorderedRows if a root reappears
+// after being yielded, rather than yielding it again. This keeps the pk of every root
+// for the whole iteration, so memory grows with the number of roots.
+func WithStrictOrder() Option {
+	return func(o *scanOptions) {
+		o.strictOrder = true
+	}
+}
+
+// newIdentityMap returns an empty identityMap if the identity map is enabled, or nil
+func (o *scanOptions) newIdentityMap() identityMap {
+	if !o.identityMap {
+		return nil
+	}
+
+	return make(identityMap)
+}
@@ -1,9 +1,9 @@
 package scansion
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"reflect"
-	"strings"
 
 	"github.com/jackc/pgx/v5"
 )
@@ -11,100 +11,141 @@ import (
 // PgxScanner wraps the pgx.Rows result set in Rows
 type PgxScanner struct {
 	Rows pgx.Rows
+
+	options scanOptions
 }
 
 // NewPgxScanner takes a pgx.Rows struct and returns a PgxScanner
-func NewPgxScanner(rows pgx.Rows) *PgxScanner {
+func NewPgxScanner(rows pgx.Rows, opts ...Option) *PgxScanner {
 	return &PgxScanner{
-		Rows: rows,
+		Rows:    rows,
+		options: newScanOptions(opts),
 	}
 }
 
 // Scan maps the wrapped Rows into the provided interface.
 // Unless exactly one result is expected (e.g. LIMIT 1 is used)
-// a slice is the expected argument.
-func (p *PgxScanner) Scan(v any) (err error) {
-	var rowCount int
-
-	defer func() {
-		p.Rows.Close()
-		if err == nil && rowCount == 0 {
-			err = pgx.ErrNoRows
-		}
-	}()
+// a slice is the expected argument. Scanning more than one distinct root
+// into a struct returns ErrTooManyRows.
+func (p *PgxScanner) Scan(v any) error {
+	return scan(context.Background(), p, v)
+}
 
-	fieldMap, err := getFieldMap(v)
-	if err != nil {
-		return err
-	}
+// ScanContext is like Scan, but stops once ctx is done, closing the Rows.
+// The error then wraps ctx.Err(), and says how many rows were read.
+func (p *PgxScanner) ScanContext(ctx context.Context, v any) error {
+	return scan(ctx, p, v)
+}
 
-	for p.Rows.Next() {
-		if err = p.scanRow(fieldMap); err != nil {
-			return err
-		}
+func (p *PgxScanner) scanOptions() *scanOptions {
+	return &p.options
+}
 
-		if err = buildResult(v, fieldMap); err != nil {
-			return err
-		}
-		rowCount++
-	}
+func (p *PgxScanner) nextRow() bool {
+	return p.Rows.Next()
+}
 
-	return nil
+func (p *PgxScanner) closeRows() {
+	p.Rows.Close()
+}
+
+func (p *PgxScanner) rowsErr() error {
+	return p.Rows.Err()
 }
 
-func (p *PgxScanner) scanRow(fm fieldMap) error {
+func (p *PgxScanner) errNoRows() error {
+	return pgx.ErrNoRows
+}
+
+func (p *PgxScanner) columnNames() ([]string, error) {
 	fieldDescriptions := p.Rows.FieldDescriptions()
-	targets := make([]any, len(fieldDescriptions))
-	fields := make([]fieldMapEntry, len(fieldDescriptions))
-	scopedNames := make([]string, len(fieldDescriptions))
+	columnNames := make([]string, len(fieldDescriptions))
+	for i, desc := range fieldDescriptions {
+		columnNames[i] = desc.Name
+	}
+
+	return columnNames, nil
+}
 
-	var path []string
+func (p *PgxScanner) columnTables(ctx context.Context) ([]string, error) {
+	if p.options.tableQuerier == nil {
+		return nil, nil
+	}
+
+	fieldDescriptions := p.Rows.FieldDescriptions()
+	oids := make([]uint32, len(fieldDescriptions))
 	for i, desc := range fieldDescriptions {
-		if strings.HasPrefix(desc.Name, scanPrefix) {
-			scanField := strings.TrimPrefix(desc.Name, scanPrefix)
-			path = strings.Split(scanField, ".")
-			continue
-		}
+		oids[i] = desc.TableOID
+	}
 
-		scopedName := strings.Join(append(path, desc.Name), ".")
-		fieldEntry, ok := fm.Map[scopedName]
-		if !ok {
-			return fmt.Errorf("field %s not defined in scan target", scopedName)
-		}
+	names, err := p.options.tableNames.lookup(ctx, p.options.tableQuerier, oids)
+	if err != nil {
+		return nil, err
+	}
 
-		targetType := fieldEntry.Type
-		if fieldEntry.Optional && targetType.Kind() != reflect.Pointer {
-			targetType = reflect.PointerTo(targetType)
-		}
+	tables := make([]string, len(oids))
+	for i, oid := range oids {
+		tables[i] = names[oid]
+	}
+
+	return tables, nil
+}
+
+func (p *PgxScanner) newTargets(plan *columnPlan) []any {
+	return plan.newTargets()
+}
 
-		targets[i] = reflect.New(targetType).Interface()
-		fields[i] = fieldEntry
-		scopedNames[i] = scopedName
+func (p *PgxScanner) failedColumn(targets []any, err error) (int, error, bool) {
+	var argErr pgx.ScanArgError
+	if !errors.As(err, &argErr) {
+		return 0, nil, false
 	}
 
+	return argErr.ColumnIndex, argErr.Err, true
+}
+
+func (p *PgxScanner) columnDBType(idx int) string {
+	fieldDescriptions := p.Rows.FieldDescriptions()
+	conn := p.Rows.Conn()
+	if idx >= len(fieldDescriptions) || conn == nil {
+		return ""
+	}
+
+	if dataType, ok := conn.TypeMap().TypeForOID(fieldDescriptions[idx].DataTypeOID); ok {
+		return dataType.Name
+	}
+	return ""
+}
+
+func (p *PgxScanner) scanRow(plan *columnPlan, targets []any, values rowValues) error {
+	plan.resetTargets(targets)
 	if err := p.Rows.Scan(targets...); err != nil {
 		return err
 	}
 
-	for idx, t := range targets {
-		if t == nil {
-			// Scan column
+	for idx, col := range plan.Columns {
+		if col.IsScanColumn || col.IsIgnored {
+			continue
+		}
+
+		targetVal := reflect.ValueOf(targets[idx]).Elem()
+		if col.IsRest {
+			storeRestValue(values, col, targetVal)
 			continue
 		}
 
-		targetVal := reflect.ValueOf(t).Elem()
-		currentField := fields[idx]
+		currentField := col.Field
 		if currentField.Optional && targetVal.Kind() == reflect.Pointer &&
 			currentField.Type.Kind() != reflect.Pointer {
 			if targetVal.IsNil() {
-				targetVal = reflect.Zero(currentField.Type)
-			} else {
-				targetVal = targetVal.Elem()
+				// NULL values are left out, like database/sql does
+				delete(values, col.ScopedName)
+				continue
 			}
+			targetVal = targetVal.Elem()
 		}
 
-		currentField.ScannedValue = targetVal
-		fm.Map[scopedNames[idx]] = currentField
+		values[col.ScopedName] = targetVal
 	}
 
 	return nil
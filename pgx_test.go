@@ -45,7 +45,7 @@ func TestPgxScan(t *testing.T) {
 			require.NoError(t, err)
 
 			target := reflect.New(testCase.targetType).Interface()
-			err = scansion.NewPgxScanner(rows).Scan(target)
+			err = scansion.NewPgxScanner(rows, testCase.options...).Scan(target)
 			require.NoError(t, err)
 			expectedJson, err := json.MarshalIndent(testCase.expected, "", "  ")
 			require.NoError(t, err)
@@ -55,6 +55,28 @@ func TestPgxScan(t *testing.T) {
 		})
 	}
 
+	for _, testCase := range errorTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			ctx := context.Background()
+			db, err := pgx.Connect(ctx, dbUrl)
+			require.NoError(t, err)
+			defer db.Close(ctx)
+
+			tx, err := db.Begin(ctx)
+			require.NoError(t, err)
+			defer tx.Rollback(ctx)
+
+			setupPgxDB(ctx, t, setupQueries, tx)
+
+			rows, err := tx.Query(ctx, testCase.query)
+			require.NoError(t, err)
+
+			target := reflect.New(testCase.targetType).Interface()
+			err = scansion.NewPgxScanner(rows, testCase.options...).Scan(target)
+			require.EqualError(t, err, testCase.expectedErr)
+		})
+	}
+
 	t.Run("no_rows", func(t *testing.T) {
 		ctx := context.Background()
 		db, err := pgx.Connect(ctx, dbUrl)
@@ -74,6 +96,261 @@ func TestPgxScan(t *testing.T) {
 		err = scansion.NewPgxScanner(rows).Scan(&book)
 		require.ErrorIs(t, err, pgx.ErrNoRows)
 	})
+
+	t.Run("too_many_rows", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		rows, err := tx.Query(ctx, "SELECT * FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+
+		var bookshelf Bookshelf
+		err = scansion.NewPgxScanner(rows).Scan(&bookshelf)
+		require.ErrorIs(t, err, scansion.ErrTooManyRows)
+	})
+
+	t.Run("select", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		bookshelves, err := scansion.Select[Bookshelf](ctx, tx, "SELECT * FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+		assert.Equal(t, []Bookshelf{{ID: 1, Name: "Daniel"}, {ID: 2, Name: "George"}}, bookshelves)
+
+		bookshelves, err = scansion.Select[Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 3)
+		require.NoError(t, err)
+		assert.Equal(t, []Bookshelf{}, bookshelves)
+
+		bookshelf, err := scansion.Get[Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 2)
+		require.NoError(t, err)
+		assert.Equal(t, Bookshelf{ID: 2, Name: "George"}, bookshelf)
+
+		bookshelfPtr, err := scansion.Get[*Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 2)
+		require.NoError(t, err)
+		assert.Equal(t, &Bookshelf{ID: 2, Name: "George"}, bookshelfPtr)
+
+		_, err = scansion.Get[Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 3)
+		require.ErrorIs(t, err, pgx.ErrNoRows)
+	})
+
+	t.Run("iter", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		testCase := getTestCase("multiple_rows")
+		rows, err := tx.Query(ctx, testCase.query)
+		require.NoError(t, err)
+
+		var authors []Author
+		for author, err := range scansion.Iter[Author](scansion.NewPgxScanner(rows)) {
+			require.NoError(t, err)
+			authors = append(authors, author)
+		}
+
+		expectedJson, err := json.MarshalIndent(testCase.expected, "", "  ")
+		require.NoError(t, err)
+		actualJson, err := json.MarshalIndent(authors, "", "  ")
+		require.NoError(t, err)
+		assert.Equal(t, string(expectedJson), string(actualJson))
+	})
+
+	t.Run("iter_unordered", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		rows, err := tx.Query(ctx, `SELECT * FROM (VALUES (1, 'a', 'x'), (2, 'b', 'y'), (1, 'a', 'x')) AS t (id, name, country)`)
+		require.NoError(t, err)
+
+		var iterErr error
+		for batch, err := range scansion.IterBatches[City](scansion.NewPgxScanner(rows, scansion.WithStrictOrder()), 1) {
+			if err != nil {
+				iterErr = err
+				break
+			}
+			require.Len(t, batch, 1)
+		}
+		require.ErrorIs(t, iterErr, scansion.ErrUnorderedRows)
+	})
+
+	t.Run("scan_context", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		rows, err := tx.Query(ctx, "SELECT * FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+
+		cancelledCtx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		var bookshelves []Bookshelf
+		err = scansion.NewPgxScanner(rows).ScanContext(cancelledCtx, &bookshelves)
+		require.ErrorIs(t, err, context.Canceled)
+		require.EqualError(t, err, "scan stopped after 0 rows: context canceled")
+
+		// The rows are closed, so the connection can run another query
+		_, err = tx.Exec(ctx, "SELECT 1")
+		require.NoError(t, err)
+
+		rows, err = tx.Query(ctx, "SELECT * FROM books ORDER BY id ASC")
+		require.NoError(t, err)
+
+		var books []Book
+		err = scansion.NewPgxScanner(rows).ScanContext(&rowLimitContext{Context: ctx, limit: 2}, &books)
+		require.ErrorIs(t, err, context.Canceled)
+		require.EqualError(t, err, "scan stopped after 2 rows: context canceled")
+
+		_, err = tx.Exec(ctx, "SELECT 1")
+		require.NoError(t, err)
+	})
+
+	t.Run("scan_error", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		rows, err := tx.Query(ctx, "SELECT id, name FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+
+		var bookshelves []MistypedBookshelf
+		err = scansion.NewPgxScanner(rows).Scan(&bookshelves)
+
+		var scanErr *scansion.ScanError
+		require.ErrorAs(t, err, &scanErr)
+		assert.Equal(t, 1, scanErr.Row)
+		assert.Equal(t, 1, scanErr.ColumnIndex)
+		assert.Equal(t, "name", scanErr.Column)
+		assert.Equal(t, "name", scanErr.Field)
+		assert.Equal(t, reflect.TypeOf(int64(0)), scanErr.GoType)
+		assert.Equal(t, "text", scanErr.DBType)
+	})
+
+	t.Run("identity_map", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		defer tx.Rollback(ctx)
+
+		setupPgxDB(ctx, t, setupQueries, tx)
+
+		rows, err := tx.Query(ctx, identityMapQuery)
+		require.NoError(t, err)
+
+		var books []SharedBook
+		err = scansion.NewPgxScanner(rows, scansion.WithIdentityMap()).Scan(&books)
+		require.NoError(t, err)
+
+		require.Len(t, books, 3)
+		assert.Same(t, books[0].Author, books[1].Author)
+		assert.Equal(t, []SharedBook{{ID: 1, Title: "Cryptonomicon"}, {ID: 2, Title: "Snow Crash"}}, books[0].Author.Books)
+		assert.Equal(t, []SharedBook{{ID: 3, Title: "Ulysses"}}, books[2].Author.Books)
+	})
+
+	t.Run("table_segments", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer db.Close(ctx)
+
+		catalogDb, err := pgx.Connect(ctx, dbUrl)
+		require.NoError(t, err)
+		defer catalogDb.Close(ctx)
+
+		// Table names are looked up from a second connection, which only sees committed tables,
+		// so they're created in a schema of their own rather than in a transaction
+		_, err = db.Exec(ctx, "DROP SCHEMA IF EXISTS table_segments CASCADE")
+		require.NoError(t, err)
+		_, err = db.Exec(ctx, "CREATE SCHEMA table_segments")
+		require.NoError(t, err)
+		defer db.Exec(ctx, "DROP SCHEMA table_segments CASCADE")
+		_, err = db.Exec(ctx, "SET search_path TO table_segments")
+		require.NoError(t, err)
+
+		tx, err := db.Begin(ctx)
+		require.NoError(t, err)
+		setupPgxDB(ctx, t, setupQueries, tx)
+		require.NoError(t, tx.Commit(ctx))
+
+		querier := &countingQuerier{PgxQuerier: catalogDb}
+
+		expected := []TableAuthor{
+			{ID: 1, Name: "Neal Stephenson", Books: []TableBook{{ID: 1, Title: "Cryptonomicon"}, {ID: 2, Title: "Snow Crash"}}},
+			{ID: 2, Name: "James Joyce", Books: []TableBook{{ID: 3, Title: "Ulysses"}}},
+		}
+		tableSegments := scansion.WithTableSegments(querier)
+		for range 2 {
+			rows, err := db.Query(ctx, tableSegmentsQuery)
+			require.NoError(t, err)
+
+			var authors []TableAuthor
+			err = scansion.NewPgxScanner(rows, tableSegments).Scan(&authors)
+			require.NoError(t, err)
+			assert.Equal(t, expected, authors)
+		}
+		// The table names are cached by the option after the first scan
+		assert.Equal(t, 1, querier.queries)
+	})
+}
+
+// countingQuerier counts the queries run on the PgxQuerier it wraps
+type countingQuerier struct {
+	scansion.PgxQuerier
+	queries int
+}
+
+func (q *countingQuerier) Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error) {
+	q.queries++
+	return q.PgxQuerier.Query(ctx, sql, args...)
 }
 
 func BenchmarkPgxScan(b *testing.B) {
@@ -103,3 +380,38 @@ func BenchmarkPgxScan(b *testing.B) {
 
 	tx.Rollback(ctx)
 }
+
+func BenchmarkPgxScanNested(b *testing.B) {
+	dbUrl, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		dbUrl = "host=localhost user=postgres dbname=scansion_test"
+	}
+
+	ctx := context.Background()
+	db, err := pgx.Connect(ctx, dbUrl)
+	require.NoError(b, err)
+	defer db.Close(ctx)
+
+	type childStruct struct {
+		Value int `db:"value,pk"`
+	}
+	type testStruct struct {
+		Value    int           `db:"value,pk"`
+		Children []childStruct `db:"children"`
+	}
+
+	tx, err := db.Begin(ctx)
+	require.NoError(b, err)
+
+	rows, err := tx.Query(ctx, `SELECT root AS value, 0 AS "scan:children", root * 10 + child AS value
+		FROM generate_series(1, $1) AS root
+		CROSS JOIN generate_series(1, 10) AS child
+		ORDER BY root, child`, b.N)
+	require.NoError(b, err)
+
+	var numbers []testStruct
+	err = scansion.NewPgxScanner(rows).Scan(&numbers)
+	require.NoError(b, err)
+
+	tx.Rollback(ctx)
+}
@@ -0,0 +1,309 @@
+package scansion
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// columnPlan maps each column of a result set onto the scan target.
+// It is compiled once per result set, so rows after the first only need to
+// decode values into the reusable targets.
+type columnPlan struct {
+	Columns []columnPlanEntry
+}
+
+type columnPlanEntry struct {
+	// Name of the column, as returned by the driver
+	Name string
+	// Scoped name of the field the column is scanned into
+	ScopedName string
+	// Path of the segment the column belongs to, as set by the last scan column
+	Segment []string
+	// Whether this is a scan column, which only marks a segment boundary
+	IsScanColumn bool
+	// Whether this column has no field, and is scanned only to be discarded
+	IsIgnored bool
+	// Whether this column has no field, and is scanned into the rest field of its segment
+	IsRest bool
+
+	Field      fieldMapEntry
+	TargetType reflect.Type
+}
+
+func newColumnPlan(fm *fieldMap, columnNames []string, columnTables []string, options *scanOptions) (*columnPlan, error) {
+	plan := &columnPlan{
+		Columns: make([]columnPlanEntry, len(columnNames)),
+	}
+	inferredSegments := inferSegments(fm, columnTables)
+
+	var path []string
+	for i, name := range columnNames {
+		if strings.HasPrefix(name, options.scanPrefix) {
+			scanField := strings.TrimPrefix(name, options.scanPrefix)
+			var err error
+			path, err = resolveScanPath(path, scanField)
+			if err != nil {
+				return nil, &ScanError{Err: err, ColumnIndex: i, Column: name}
+			}
+
+			plan.Columns[i] = columnPlanEntry{
+				Name:         name,
+				Segment:      path,
+				IsScanColumn: true,
+			}
+			continue
+		}
+
+		segment := path
+		if inferredSegment, ok := inferredSegments[i]; ok {
+			segment = inferredSegment
+		}
+
+		scopedName := strings.Join(append(segment, name), ".")
+		if options.pathSeparator != "" && strings.Contains(name, options.pathSeparator) {
+			// The column name holds the full path of its field
+			columnPath := strings.Split(name, options.pathSeparator)
+			if slices.Contains(columnPath, "") {
+				return nil, &ScanError{
+					Err:         fmt.Errorf("%w: path has an empty segment", ErrMalformedColumn),
+					ColumnIndex: i,
+					Column:      name,
+				}
+			}
+			scopedName = strings.Join(columnPath, ".")
+			segment = columnPath[:len(columnPath)-1]
+		}
+
+		fieldEntry, ok := fm.Map[scopedName]
+		if restSegment, hasRest := getRestSegment(fm, segment, options); !ok && hasRest {
+			plan.Columns[i] = columnPlanEntry{
+				Name:       name,
+				ScopedName: scopedName,
+				Segment:    restSegment,
+				IsRest:     true,
+				TargetType: anyType,
+			}
+			continue
+		}
+		if !ok {
+			if options.unknownColumns != UnknownColumnsIgnore {
+				return nil, &ScanError{
+					Err:         ErrUnknownColumn,
+					ColumnIndex: i,
+					Column:      name,
+					Field:       scopedName,
+					Suggestions: suggestFields(fm, segment, scopedName[strings.LastIndex(scopedName, ".")+1:]),
+				}
+			}
+
+			plan.Columns[i] = columnPlanEntry{
+				Name:       name,
+				Segment:    segment,
+				IsIgnored:  true,
+				TargetType: anyType,
+			}
+			continue
+		}
+
+		targetType := fieldEntry.Type
+		if fieldEntry.Optional && targetType.Kind() != reflect.Pointer {
+			targetType = reflect.PointerTo(targetType)
+		}
+
+		plan.Columns[i] = columnPlanEntry{
+			Name:       name,
+			ScopedName: scopedName,
+			Segment:    segment,
+			Field:      fieldEntry,
+			TargetType: targetType,
+		}
+	}
+
+	if err := plan.checkPkColumns(fm); err != nil {
+		return nil, err
+	}
+	if options.strictFields {
+		if err := plan.checkUnfilledFields(fm); err != nil {
+			return nil, err
+		}
+	}
+
+	return plan, nil
+}
+
+// resolveScanPath returns the segment a scan column moves to from the current segment.
+// An empty path or "." moves to the root. A path starting with one "^" per level
+// moves up from the current segment, and can continue down into a relation after a ".",
+// e.g. "^.reviews" from "books" moves to "reviews". Any other path is absolute.
+func resolveScanPath(current []string, scanField string) ([]string, error) {
+	if scanField == "" || scanField == "." {
+		return nil, nil
+	}
+
+	relative := strings.TrimLeft(scanField, "^")
+	up := len(scanField) - len(relative)
+	if up > len(current) {
+		return nil, fmt.Errorf("%w: moves above the root segment", ErrMalformedColumn)
+	}
+
+	path := slices.Clone(current[:len(current)-up])
+	if up == 0 {
+		path = nil
+	} else if relative == "" {
+		return path, nil
+	} else if !strings.HasPrefix(relative, ".") {
+		return nil, fmt.Errorf("%w: parent moves must be followed by . and a path", ErrMalformedColumn)
+	} else {
+		relative = relative[1:]
+	}
+
+	segments := strings.Split(relative, ".")
+	if slices.Contains(segments, "") {
+		return nil, fmt.Errorf("%w: path has an empty segment", ErrMalformedColumn)
+	}
+	if slices.ContainsFunc(segments, func(segment string) bool {
+		return strings.Contains(segment, "^")
+	}) {
+		return nil, fmt.Errorf("%w: parent moves must be at the start of the path", ErrMalformedColumn)
+	}
+
+	return append(path, segments...), nil
+}
+
+// checkPkColumns ensures every slice being merged by pk has its pk columns in the result set.
+// Without them every row would get the zero pk, and be merged into a single entity.
+func (c *columnPlan) checkPkColumns(fm *fieldMap) error {
+	scannedNames := make(map[string]bool)
+	for _, col := range c.Columns {
+		if !col.IsScanColumn {
+			scannedNames[col.ScopedName] = true
+		}
+	}
+
+	hasColumns := func(sliceName string) bool {
+		return slices.ContainsFunc(c.Columns, func(col columnPlanEntry) bool {
+			return strings.HasPrefix(col.ScopedName, sliceName+".")
+		})
+	}
+
+	for _, sliceName := range fm.mergedSlices {
+		// A nested slice without any columns is never built, so it doesn't need a pk
+		if sliceName != "" && !hasColumns(sliceName) {
+			continue
+		}
+
+		for _, pkName := range fm.pkNames[sliceName] {
+			if scannedNames[pkName] {
+				continue
+			}
+
+			pkColumn := pkName[strings.LastIndex(pkName, ".")+1:]
+			if sliceName == "" {
+				return fmt.Errorf("%w: root segment is missing pk column %s", ErrNoPrimaryKey, pkColumn)
+			}
+			return fmt.Errorf("%w: segment %s is missing pk column %s", ErrNoPrimaryKey, sliceName, pkColumn)
+		}
+	}
+
+	// Maps keyed by a column need it just like others need their pk
+	for _, mapName := range slices.Sorted(maps.Keys(fm.Map)) {
+		keyColumn := fm.Map[mapName].MapKeyColumn
+		if keyColumn == "" || !hasColumns(mapName) || scannedNames[mapName+"."+keyColumn] {
+			continue
+		}
+		return fmt.Errorf("%w: segment %s is missing key column %s", ErrNoPrimaryKey, mapName, keyColumn)
+	}
+
+	return nil
+}
+
+// checkUnfilledFields ensures every field of fm, other than relations, is populated by a column
+func (c *columnPlan) checkUnfilledFields(fm *fieldMap) error {
+	scannedNames := make(map[string]bool)
+	for _, col := range c.Columns {
+		if !col.IsScanColumn && !col.IsIgnored && !col.IsRest {
+			scannedNames[col.ScopedName] = true
+		}
+	}
+
+	var unfilled []string
+	for scopedName := range fm.Map {
+		// Relations are filled by the columns of their own segment
+		if scopedName == "" || len(fm.children[scopedName]) > 0 || scannedNames[scopedName] {
+			continue
+		}
+		unfilled = append(unfilled, scopedName)
+	}
+
+	if len(unfilled) > 0 {
+		slices.Sort(unfilled)
+		return fmt.Errorf("%w: %s", ErrUnfilledField, strings.Join(unfilled, ", "))
+	}
+
+	return nil
+}
+
+// getRestSegment returns the segment whose rest field collects the unknown columns of segment.
+// That's segment itself, or with UnknownColumnsRest, its closest ancestor with a rest field.
+func getRestSegment(fm *fieldMap, segment []string, options *scanOptions) ([]string, bool) {
+	for restSegment := segment; ; restSegment = restSegment[:len(restSegment)-1] {
+		if _, ok := fm.rest[strings.Join(restSegment, ".")]; ok {
+			return restSegment, true
+		}
+		if options.unknownColumns != UnknownColumnsRest || len(restSegment) == 0 {
+			return nil, false
+		}
+	}
+}
+
+// restValuesKey returns the key of the rest values of a segment in rowValues.
+// Scoped names can't contain a comma, so it can't clash with a field.
+func restValuesKey(segmentName string) string {
+	return segmentName + "," + dbTagOptionRest
+}
+
+// storeRestValue stores the value of a rest column in the rest values of its segment,
+// under its column name, scoped by the relations between them for a column of a nested segment
+func storeRestValue(values rowValues, col columnPlanEntry, value reflect.Value) {
+	segmentName := strings.Join(col.Segment, ".")
+	key := restValuesKey(segmentName)
+	restValues, ok := values[key]
+	if !ok {
+		restValues = reflect.ValueOf(make(map[string]any))
+		values[key] = restValues
+	}
+
+	columnName := col.ScopedName
+	if segmentName != "" {
+		columnName = strings.TrimPrefix(columnName, segmentName+".")
+	}
+	restValues.SetMapIndex(reflect.ValueOf(columnName), value)
+}
+
+// newTargets allocates one scan target per column, which can be reused for every row.
+// Scan columns are left nil.
+func (c *columnPlan) newTargets() []any {
+	targets := make([]any, len(c.Columns))
+	for i, col := range c.Columns {
+		if col.IsScanColumn {
+			continue
+		}
+		targets[i] = reflect.New(col.TargetType).Interface()
+	}
+
+	return targets
+}
+
+// resetTargets zeroes the targets, so no value from the previous row
+// can leak into the next one
+func (c *columnPlan) resetTargets(targets []any) {
+	for i, col := range c.Columns {
+		if col.IsScanColumn {
+			continue
+		}
+		reflect.ValueOf(targets[i]).Elem().SetZero()
+	}
+}
@@ -0,0 +1,64 @@
+package scansion
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// PgxQuerier is implemented by *pgx.Conn, *pgxpool.Pool and pgx.Tx
+type PgxQuerier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+// SqlQuerier is implemented by *sql.DB, *sql.Tx and *sql.Conn
+type SqlQuerier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+// Select runs the query on q and scans every row into a slice of T.
+// An empty result set returns an empty slice rather than an error.
+func Select[T any](ctx context.Context, q PgxQuerier, query string, args ...any) ([]T, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll[T](ctx, NewPgxScanner(rows))
+}
+
+// Get runs the query on q and scans the rows into a single T.
+// An empty result set returns pgx.ErrNoRows,
+// and more than one distinct root returns ErrTooManyRows.
+func Get[T any](ctx context.Context, q PgxQuerier, query string, args ...any) (T, error) {
+	rows, err := q.Query(ctx, query, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return scanOne[T](ctx, NewPgxScanner(rows))
+}
+
+// SelectSql is like Select, for a database/sql handle
+func SelectSql[T any](ctx context.Context, q SqlQuerier, query string, args ...any) ([]T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanAll[T](ctx, NewSqlScanner(rows))
+}
+
+// GetSql is like Get, for a database/sql handle.
+// An empty result set returns sql.ErrNoRows.
+func GetSql[T any](ctx context.Context, q SqlQuerier, query string, args ...any) (T, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return scanOne[T](ctx, NewSqlScanner(rows))
+}
@@ -1,8 +1,239 @@
 // Scansion is a library for scanning SQL result sets into Go structs.
 package scansion
 
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// ErrTooManyRows is returned when scanning into a single struct,
+// and the rows contain more than one distinct root pk.
+var ErrTooManyRows = errors.New("too many rows in result set")
+
 // Scanner is generic interface for scanning from a DB.
 // All supported library-specific scanners implement this.
 type Scanner interface {
 	Scan(v any) error
 }
+
+// ContextScanner is a Scanner which can stop scanning when a context is done.
+// All supported library-specific scanners implement this.
+type ContextScanner interface {
+	Scanner
+
+	// ScanContext is like Scan, but checks ctx between rows.
+	// Once ctx is done the rows are closed, and ctx.Err() is returned,
+	// wrapped with the number of rows read so far.
+	ScanContext(ctx context.Context, v any) error
+}
+
+// ScanAll scans every row of the Scanner into a slice of T.
+// Unlike Scan, an empty result set returns an empty slice rather than an error.
+func ScanAll[T any](s Scanner) ([]T, error) {
+	return scanAll[T](context.Background(), s)
+}
+
+func scanAll[T any](ctx context.Context, s Scanner) ([]T, error) {
+	var result []T
+	if err := scanContext(ctx, s, &result); err != nil {
+		// pgx.ErrNoRows also matches sql.ErrNoRows
+		if errors.Is(err, sql.ErrNoRows) {
+			return []T{}, nil
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// ScanOne scans the Scanner's rows into a single T, which can be a struct or struct pointer.
+// An empty result set returns the Scanner's ErrNoRows,
+// and more than one distinct root returns ErrTooManyRows.
+func ScanOne[T any](s Scanner) (T, error) {
+	return scanOne[T](context.Background(), s)
+}
+
+func scanOne[T any](ctx context.Context, s Scanner) (T, error) {
+	var result T
+	target := any(&result)
+	if resultType := reflect.TypeFor[T](); resultType.Kind() == reflect.Pointer {
+		// A pointer T is scanned through a new value it points to
+		ptr := reflect.New(resultType.Elem())
+		reflect.ValueOf(&result).Elem().Set(ptr)
+		target = ptr.Interface()
+	}
+
+	if err := scanContext(ctx, s, target); err != nil {
+		var zero T
+		return zero, err
+	}
+
+	return result, nil
+}
+
+// scanContext scans with ctx if s is a ContextScanner, and ignores ctx otherwise
+func scanContext(ctx context.Context, s Scanner, v any) error {
+	if cs, ok := s.(ContextScanner); ok {
+		return cs.ScanContext(ctx, v)
+	}
+
+	return s.Scan(v)
+}
+
+// rowScanner is implemented by the library-specific scanners,
+// and gives the shared scanning logic row-by-row access to the result set
+type rowScanner interface {
+	Scanner
+
+	scanOptions() *scanOptions
+	nextRow() bool
+	columnNames() ([]string, error)
+	newTargets(plan *columnPlan) []any
+	scanRow(plan *columnPlan, targets []any, values rowValues) error
+	// failedColumn returns the index of the column a scanRow error comes from,
+	// and the error of that column alone. If it can't be told, ok is false.
+	failedColumn(targets []any, err error) (idx int, columnErr error, ok bool)
+	// columnDBType returns the database type name of a column, or "" if it's unknown
+	columnDBType(idx int) string
+	closeRows()
+	rowsErr() error
+	errNoRows() error
+}
+
+// tableScanner is implemented by the scanners which can tell the table each column comes from
+type tableScanner interface {
+	// columnTables returns the table of each column, or "" if it has none.
+	// If tables aren't being used, it returns nil.
+	columnTables(ctx context.Context) ([]string, error)
+}
+
+// rowReader reads each row of a rowScanner into values,
+// compiling the column plan when the first row is read
+type rowReader struct {
+	scanner  rowScanner
+	fieldMap *fieldMap
+	plan     *columnPlan
+	targets  []any
+	values   rowValues
+
+	// Used to store the number of rows read, for errors
+	rowCount int
+}
+
+func newRowReader(scanner rowScanner, fieldMap *fieldMap) *rowReader {
+	return &rowReader{
+		scanner:  scanner,
+		fieldMap: fieldMap,
+		values:   make(rowValues),
+	}
+}
+
+// next reads the next row, and returns false once the rows are exhausted.
+// If ctx is done, no more rows are read.
+func (r *rowReader) next(ctx context.Context) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, fmt.Errorf("scan stopped after %d rows: %w", r.rowCount, err)
+	}
+
+	if !r.scanner.nextRow() {
+		return false, r.scanner.rowsErr()
+	}
+	r.rowCount++
+
+	if r.plan == nil {
+		columnNames, err := r.scanner.columnNames()
+		if err != nil {
+			return false, err
+		}
+
+		var columnTables []string
+		if ts, ok := r.scanner.(tableScanner); ok {
+			if columnTables, err = ts.columnTables(ctx); err != nil {
+				return false, err
+			}
+		}
+
+		if r.plan, err = newColumnPlan(r.fieldMap, columnNames, columnTables, r.scanner.scanOptions()); err != nil {
+			return false, err
+		}
+		r.targets = r.scanner.newTargets(r.plan)
+	}
+
+	if err := r.scanner.scanRow(r.plan, r.targets, r.values); err != nil {
+		if idx, columnErr, ok := r.scanner.failedColumn(r.targets, err); ok {
+			col := r.plan.Columns[idx]
+			err = &ScanError{
+				Err:         columnErr,
+				ColumnIndex: idx,
+				Column:      col.Name,
+				Field:       col.ScopedName,
+				GoType:      col.Field.Type,
+				DBType:      r.scanner.columnDBType(idx),
+				Row:         r.rowCount,
+			}
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func scan(ctx context.Context, s rowScanner, v any) (err error) {
+	var rowCount int
+
+	defer func() {
+		s.closeRows()
+		if err == nil && rowCount == 0 {
+			err = s.errNoRows()
+		}
+	}()
+
+	fieldMap, err := getFieldMap(v, s.scanOptions())
+	if err != nil {
+		return err
+	}
+
+	isStruct := reflect.TypeOf(v).Elem().Kind() == reflect.Struct
+	var rootPk any
+
+	reader := newRowReader(s, fieldMap)
+	index := make(mergeIndex)
+	identities := s.scanOptions().newIdentityMap()
+	for {
+		ok, err := reader.next(ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+
+		if isStruct {
+			// Rows repeating the root because of joins are fine, but a second root isn't
+			rowPk, hasPk, err := fieldMap.getRowPkKey(reader.values, "")
+			if err != nil {
+				return err
+			}
+			if hasPk {
+				if rowCount > 0 && rowPk != rootPk {
+					return ErrTooManyRows
+				}
+				rootPk = rowPk
+			}
+		}
+
+		if err = buildResult(v, fieldMap, reader.values, index, identities); err != nil {
+			return err
+		}
+		rowCount++
+	}
+
+	if len(fieldMap.trees) > 0 {
+		return fieldMap.assembleTrees(reflect.ValueOf(v))
+	}
+
+	return nil
+}
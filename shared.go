@@ -3,55 +3,171 @@ package scansion
 import (
 	"errors"
 	"fmt"
+	"maps"
 	"reflect"
+	"strconv"
 	"strings"
 )
 
-func buildResult(v any, fieldMap fieldMap) error {
+// sliceIndex maps the pk of each element in a slice being built to its position,
+// so rows can be merged into existing elements without searching the slice
+type sliceIndex struct {
+	positions map[any]int
+
+	// Used to store the indexes of the slices nested in each element
+	nested []mergeIndex
+}
+
+// mergeIndex stores a sliceIndex for each slice nested in a value,
+// keyed by the path of struct field indexes leading to it
+type mergeIndex map[string]*sliceIndex
+
+func (m mergeIndex) get(path string) *sliceIndex {
+	index, ok := m[path]
+	if !ok {
+		index = &sliceIndex{
+			positions: make(map[any]int),
+		}
+		m[path] = index
+	}
+
+	return index
+}
+
+// find returns the position of the element with the given pk,
+// first indexing any elements appended since the last call
+func (s *sliceIndex) find(fieldMap *fieldMap, slice reflect.Value, pk any) (int, bool, error) {
+	for i := len(s.nested); i < slice.Len(); i++ {
+		elemPk, err := fieldMap.getPkKey(slice.Index(i))
+		if err != nil {
+			return 0, false, err
+		}
+		if _, ok := s.positions[elemPk]; !ok {
+			s.positions[elemPk] = i
+		}
+		s.nested = append(s.nested, make(mergeIndex))
+	}
+
+	pos, ok := s.positions[pk]
+	return pos, ok, nil
+}
+
+func fieldIdxPath(prefix string, idx ...int) string {
+	var b strings.Builder
+	b.WriteString(prefix)
+	for _, i := range idx {
+		b.WriteByte('.')
+		b.WriteString(strconv.Itoa(i))
+	}
+
+	return b.String()
+}
+
+func buildResult(v any, fieldMap *fieldMap, values rowValues, index mergeIndex, identities identityMap) error {
 	val := reflect.ValueOf(v)
 	if val.Kind() == reflect.Pointer {
 		val = val.Elem()
 	}
 
-	if val.Kind() == reflect.Slice {
+	if val.Kind() == reflect.Slice || val.Kind() == reflect.Map {
 		sliceElem := reflect.New(val.Type().Elem()).Elem()
-		if err := buildHelper(fieldMap, nil, sliceElem); err != nil {
+		if sliceElem.Kind() == reflect.Pointer {
+			// Every row has a root, so unlike a relation pointer it's allocated even if all its values are zero
+			sliceElem.Set(reflect.New(sliceElem.Type().Elem()))
+		}
+		if err := buildHelper(fieldMap, values, make(mergeIndex), "", nil, sliceElem); err != nil {
 			return err
 		}
-		if err := sliceMerge(fieldMap, val, sliceElem); err != nil {
+		if identities != nil {
+			if err := identities.resolve(fieldMap, sliceElem); err != nil {
+				return err
+			}
+		}
+		if val.Kind() == reflect.Map {
+			if err := mapMerge(fieldMap, index.get(""), val, sliceElem, nil); err != nil {
+				return err
+			}
+		} else if err := sliceMerge(fieldMap, index.get(""), val, sliceElem); err != nil {
+			return err
+		}
+	} else if identities != nil && len(index) > 0 {
+		// Resolving the whole root again for every row would be quadratic in its relations,
+		// so once they're being merged, each row is built and resolved on its own first
+		rowVal := reflect.New(val.Type()).Elem()
+		if err := buildHelper(fieldMap, values, make(mergeIndex), "", nil, rowVal); err != nil {
+			return err
+		}
+		if err := identities.resolve(fieldMap, rowVal); err != nil {
+			return err
+		}
+		if err := structMerge(fieldMap, index, "", val, rowVal); err != nil {
 			return err
 		}
 	} else {
-		if err := buildHelper(fieldMap, nil, val); err != nil {
+		if err := buildHelper(fieldMap, values, index, "", nil, val); err != nil {
 			return err
 		}
+		if identities != nil {
+			if err := identities.resolve(fieldMap, val); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-func buildHelper(fieldMap fieldMap, path []string, target reflect.Value) error {
-	for _, childName := range getChildren(fieldMap, path) {
+func buildHelper(fieldMap *fieldMap, values rowValues, index mergeIndex, idxPath string, path []string, target reflect.Value) error {
+	if target.Kind() == reflect.Interface {
+		if _, ok := fieldMap.variants[strings.Join(path, ".")]; ok {
+			return buildVariant(fieldMap, values, index, idxPath, path, target)
+		}
+	}
+
+	for _, childName := range fieldMap.children[strings.Join(path, ".")] {
 		newPath := append(path, childName)
 		childPath := strings.Join(newPath, ".")
 		childField := fieldMap.Map[childPath]
+		scannedValue := values[childPath]
 
-		if childField.Flat && childField.ScannedValue.IsValid() {
-			target.FieldByIndex(childField.StructIdx).Set(childField.ScannedValue)
+		structIdx := childField.StructIdx
+		if childField.Variants != nil {
+			// Fields of an interface relation are only set on the variants which have them
+			var ok bool
+			if !target.IsValid() {
+				continue
+			}
+			if structIdx, ok = childField.Variants[derefType(target.Type())]; !ok {
+				continue
+			}
+		}
+
+		// Fields of embedded and inline structs are set whenever they aren't NULL,
+		// so a nil embedded struct pointer is only allocated if one of its columns isn't NULL.
+		// A nil relation pointer is only allocated for a non-zero value,
+		// so it stays nil when its join had no match.
+		isNull := !scannedValue.IsValid() || (scannedValue.Kind() == reflect.Pointer && scannedValue.IsNil())
+		if !isNull && (childField.Flat || len(structIdx) > 1) &&
+			(target.Kind() != reflect.Pointer || !target.IsNil() || !scannedValue.IsZero()) {
+			fieldByIndexAlloc(target, structIdx).Set(scannedValue)
 		}
 
 		childType := childField.Type
 		if childType.Kind() == reflect.Pointer {
 			childType = childType.Elem()
 		}
+		isMapRelation := childType.Kind() == reflect.Map && !childField.Flat &&
+			isRelationType(childType.Elem())
 
 		var childTarget reflect.Value
-		switch childType.Kind() {
-		case reflect.Slice:
+		switch {
+		case childType.Kind() == reflect.Slice || isMapRelation:
 			childTarget = reflect.New(childField.Type.Elem()).Elem()
-		case reflect.Struct:
+		case childType.Kind() == reflect.Interface && fieldMap.variants[childPath] != nil:
+			childTarget = reflect.New(childType).Elem()
+		case childType.Kind() == reflect.Struct:
 			if childField.Flat {
-				childTarget = childField.ScannedValue
+				childTarget = scannedValue
 			} else {
 				localTarget := target
 				if localTarget.Kind() == reflect.Pointer {
@@ -59,16 +175,21 @@ func buildHelper(fieldMap fieldMap, path []string, target reflect.Value) error {
 				}
 
 				if localTarget.IsValid() {
-					childTarget = localTarget.FieldByIndex(childField.StructIdx)
+					childTarget = fieldByIndexAlloc(localTarget, structIdx)
 				}
 			}
-		case reflect.Pointer:
-			fallthrough
 		default:
-			childTarget = childField.ScannedValue
+			childTarget = scannedValue
 		}
 
-		if err := buildHelper(fieldMap, newPath, childTarget); err != nil {
+		childIdxPath := fieldIdxPath(idxPath, structIdx...)
+		childIndex := index
+		if childType.Kind() == reflect.Slice || isMapRelation {
+			// A slice or map element is built from scratch for each row, so it starts with a fresh index
+			childIndex = make(mergeIndex)
+		}
+
+		if err := buildHelper(fieldMap, values, childIndex, childIdxPath, newPath, childTarget); err != nil {
 			return err
 		}
 
@@ -82,9 +203,13 @@ func buildHelper(fieldMap fieldMap, path []string, target reflect.Value) error {
 			}
 
 			if localTarget.Kind() == reflect.Struct {
-				targetField := localTarget.FieldByIndex(childField.StructIdx)
-				if targetField.Kind() == reflect.Slice {
-					if err := sliceMerge(fieldMap, targetField, childTarget); err != nil {
+				targetField := fieldByIndexAlloc(localTarget, structIdx)
+				if isMapRelation {
+					if err := mapMerge(fieldMap, index.get(childIdxPath), targetField, childTarget, childField.MapKeyIdx); err != nil {
+						return err
+					}
+				} else if targetField.Kind() == reflect.Slice {
+					if err := sliceMerge(fieldMap, index.get(childIdxPath), targetField, childTarget); err != nil {
 						return err
 					}
 				} else {
@@ -96,10 +221,47 @@ func buildHelper(fieldMap fieldMap, path []string, target reflect.Value) error {
 		}
 	}
 
+	setRestField(fieldMap, values, path, target)
 	return nil
 }
 
-func sliceMerge(fieldMap fieldMap, slice, elem reflect.Value) error {
+// setRestField sets the rest field of the segment at path to a copy of its rest values.
+// If they're all NULL in a nested segment it's left unset, so a relation whose join had no match stays empty.
+// The root has no join, so its NULL columns are kept like any others.
+func setRestField(fieldMap *fieldMap, values rowValues, path []string, target reflect.Value) {
+	segmentName := strings.Join(path, ".")
+	restField, ok := fieldMap.rest[segmentName]
+	if !ok || !target.IsValid() {
+		return
+	}
+	restValues, ok := values[restValuesKey(segmentName)]
+	if !ok {
+		return
+	}
+
+	structIdx := restField.StructIdx
+	if restField.Variants != nil {
+		if structIdx, ok = restField.Variants[derefType(target.Type())]; !ok {
+			return
+		}
+	}
+
+	rest := restValues.Interface().(map[string]any)
+	allNull := len(path) > 0
+	for _, value := range rest {
+		if value != nil {
+			allNull = false
+			break
+		}
+	}
+	if allNull {
+		return
+	}
+
+	fieldByIndexAlloc(target, structIdx).Set(reflect.ValueOf(maps.Clone(rest)))
+}
+
+func sliceMerge(fieldMap *fieldMap, index *sliceIndex, slice, elem reflect.Value) error {
 	if slice.Kind() != reflect.Slice {
 		return errors.New("first argument must be a slice")
 	}
@@ -108,51 +270,134 @@ func sliceMerge(fieldMap fieldMap, slice, elem reflect.Value) error {
 		return errors.New("both values must have the same primitve type")
 	}
 
-	startingSliceLen := slice.Len()
-	for i := range startingSliceLen {
-		sliceVal := slice.Index(i)
-		slicePk, err := fieldMap.getPkValue(sliceVal)
+	// Keyless elements are never merged, so every row appends a new one
+	if slice.Len() == 0 || fieldMap.keylessTypes[structTypeOf(elem)] {
+		slice.Set(reflect.Append(slice, elem))
+		return nil
+	}
+
+	elemPk, err := fieldMap.getPkKey(elem)
+	if err != nil {
+		return err
+	}
+
+	pos, ok, err := index.find(fieldMap, slice, elemPk)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		slice.Set(reflect.Append(slice, elem))
+		return nil
+	}
+
+	origElem := slice.Index(pos)
+	if elem.Kind() == reflect.Interface {
+		merged, err := mergeVariant(fieldMap, index.nested[pos], "", origElem, elem)
 		if err != nil {
 			return err
 		}
-		elemPk, err := fieldMap.getPkValue(elem)
+		origElem.Set(merged)
+		return nil
+	}
+	if elem.Kind() == reflect.Pointer {
+		if elem.Pointer() == origElem.Pointer() {
+			return nil
+		}
+		origElem, elem = origElem.Elem(), elem.Elem()
+	}
+
+	return structMerge(fieldMap, index.nested[pos], "", origElem, elem)
+}
+
+// mapMerge merges elem into the map m, keyed by the field at keyIdx,
+// or by its pk if keyIdx is nil
+func mapMerge(fieldMap *fieldMap, index *sliceIndex, m, elem reflect.Value, keyIdx []int) error {
+	if m.Type().Elem() != elem.Type() {
+		return errors.New("both values must have the same primitve type")
+	}
+
+	var key reflect.Value
+	if keyIdx != nil {
+		var err error
+		if key, err = reflect.Indirect(elem).FieldByIndexErr(keyIdx); err != nil {
+			return err
+		}
+	} else {
+		pkValues, err := fieldMap.getPkValues(elem)
 		if err != nil {
 			return err
 		}
+		if len(pkValues) != 1 {
+			return fmt.Errorf("%w: map of %s can't be keyed by a composite pk", ErrInvalidTag, derefType(elem.Type()))
+		}
+		key = pkValues[0]
+	}
 
-		if !slicePk.Equal(elemPk) {
-			// Only append if we're out of options
-			if i == startingSliceLen-1 {
-				slice.Set(reflect.Append(slice, elem))
-			}
-			continue
+	// The key type was checked by checkMapKey, so only a pointer needs dereferencing
+	keyType := m.Type().Key()
+	if key.Kind() == reflect.Pointer && !key.Type().AssignableTo(keyType) && !key.IsNil() {
+		key = key.Elem()
+	}
+	if !key.Type().AssignableTo(keyType) {
+		return fmt.Errorf("%w: key of type %s can't be used as a key of %s", ErrInvalidTag, key.Type(), m.Type())
+	}
+
+	return mapMergeEntry(fieldMap, index, m, key, elem)
+}
+
+// mapMergeEntry stores elem in the map m under key,
+// merging it into the existing element if there is one
+func mapMergeEntry(fieldMap *fieldMap, index *sliceIndex, m, key, elem reflect.Value) error {
+	if m.IsNil() {
+		m.Set(reflect.MakeMap(m.Type()))
+	}
+
+	normalizedKey, err := normalizeKey(key)
+	if err != nil {
+		return err
+	}
+
+	pos, ok := index.positions[normalizedKey]
+	if !ok {
+		pos = len(index.nested)
+		index.positions[normalizedKey] = pos
+		index.nested = append(index.nested, make(mergeIndex))
+	}
+
+	origElem := m.MapIndex(key)
+	if !origElem.IsValid() || fieldMap.keylessTypes[structTypeOf(elem)] {
+		m.SetMapIndex(key, elem)
+		return nil
+	}
+
+	if elem.Kind() == reflect.Interface {
+		merged, err := mergeVariant(fieldMap, index.nested[pos], "", origElem, elem)
+		if err != nil {
+			return err
 		}
+		m.SetMapIndex(key, merged)
+		return nil
+	}
 
-		for fieldIdx := 0; fieldIdx < elem.NumField(); fieldIdx++ {
-			sliceValField := sliceVal.Field(fieldIdx)
-			elemField := elem.Field(fieldIdx)
-			if elemField.Kind() == reflect.Slice && elemField.Type().Elem().Kind() == reflect.Struct {
-				for elemIdx := 0; elemIdx < elemField.Len(); elemIdx++ {
-					if err := sliceMerge(fieldMap, sliceValField, elemField.Index(elemIdx)); err != nil {
-						return err
-					}
-				}
-			} else if elemField.Kind() == reflect.Struct {
-				if err := structMerge(fieldMap, sliceValField, elemField); err != nil {
-					return err
-				}
-			}
+	if elem.Kind() == reflect.Pointer {
+		if elem.Pointer() == origElem.Pointer() {
+			return nil
 		}
+		return structMerge(fieldMap, index.nested[pos], "", origElem.Elem(), elem.Elem())
 	}
 
-	if slice.Len() == 0 {
-		slice.Set(reflect.Append(slice, elem))
+	// Map elements aren't addressable, so the merge is done on a copy
+	merged := reflect.New(elem.Type()).Elem()
+	merged.Set(origElem)
+	if err := structMerge(fieldMap, index.nested[pos], "", merged, elem); err != nil {
+		return err
 	}
+	m.SetMapIndex(key, merged)
 
 	return nil
 }
 
-func structMerge(fieldMap fieldMap, origStruct, newStruct reflect.Value) error {
+func structMerge(fieldMap *fieldMap, index mergeIndex, idxPath string, origStruct, newStruct reflect.Value) error {
 	if origStruct.Kind() != reflect.Struct {
 		return errors.New("first argument must be a struct")
 	}
@@ -162,18 +407,53 @@ func structMerge(fieldMap fieldMap, origStruct, newStruct reflect.Value) error {
 	}
 
 	for fieldIdx := 0; fieldIdx < origStruct.NumField(); fieldIdx++ {
-		sliceValField := origStruct.Field(fieldIdx)
-		elemField := newStruct.Field(fieldIdx)
-		if sliceValField.Kind() == reflect.Struct {
-			if err := structMerge(fieldMap, sliceValField, elemField); err != nil {
-				return err
+		origField := origStruct.Field(fieldIdx)
+		newField := newStruct.Field(fieldIdx)
+		if !origField.CanSet() {
+			continue
+		}
+
+		fieldPath := fieldIdxPath(idxPath, fieldIdx)
+		switch {
+		case newField.Kind() == reflect.Slice && isRelationType(newField.Type().Elem()):
+			fieldIndex := index.get(fieldPath)
+			for elemIdx := 0; elemIdx < newField.Len(); elemIdx++ {
+				if err := sliceMerge(fieldMap, fieldIndex, origField, newField.Index(elemIdx)); err != nil {
+					return err
+				}
 			}
-		} else if sliceValField.Kind() == reflect.Slice {
-			for elemIdx := 0; elemIdx < elemField.Len(); elemIdx++ {
-				if err := sliceMerge(fieldMap, sliceValField, elemField.Index(elemIdx)); err != nil {
+		case newField.Kind() == reflect.Map && isRelationType(newField.Type().Elem()):
+			fieldIndex := index.get(fieldPath)
+			for iter := newField.MapRange(); iter.Next(); {
+				if err := mapMergeEntry(fieldMap, fieldIndex, origField, iter.Key(), iter.Value()); err != nil {
 					return err
 				}
 			}
+		case newField.Kind() == reflect.Interface && !newField.IsNil():
+			if _, ok := getVariants(newField.Type()); !ok {
+				continue
+			}
+			merged, err := mergeVariant(fieldMap, index, fieldPath, origField, newField)
+			if err != nil {
+				return err
+			}
+			origField.Set(merged)
+		case newField.Kind() == reflect.Struct:
+			if err := structMerge(fieldMap, index, fieldPath, origField, newField); err != nil {
+				return err
+			}
+		case newField.Kind() == reflect.Pointer && newField.Type().Elem().Kind() == reflect.Struct:
+			// Shared instances from the identity map are already up to date
+			if newField.IsNil() || newField.Pointer() == origField.Pointer() {
+				continue
+			}
+			if origField.IsNil() {
+				origField.Set(newField)
+				continue
+			}
+			if err := structMerge(fieldMap, index, fieldPath, origField.Elem(), newField.Elem()); err != nil {
+				return err
+			}
 		}
 	}
 
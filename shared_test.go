@@ -1,12 +1,14 @@
 package scansion_test
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"reflect"
 	"regexp"
 	"time"
 
+	"github.com/dacohen/scansion"
 	"github.com/jackc/pgx/v5/pgtype"
 )
 
@@ -109,6 +111,301 @@ type Bookshelf struct {
 	Books []Book `db:"books"`
 }
 
+type BookBookshelf struct {
+	BookID      int64 `db:"book_id,pk"`
+	BookshelfID int64 `db:"bookshelf_id,pk"`
+
+	Bookshelf Bookshelf `db:"bookshelf"`
+}
+
+type BookshelfEntry struct {
+	scansion.Keyless
+
+	Title string `db:"title"`
+
+	Bookshelf Bookshelf `db:"bookshelf"`
+}
+
+type BaseModel struct {
+	ID int64 `db:"id,pk"`
+}
+
+// Tenant's pk is composite, made of its own tenant_id and the embedded id
+type Tenant struct {
+	TenantID int64  `db:"tenant_id,pk"`
+	Name     string `db:"name"`
+	BaseModel
+}
+
+type EmbeddedBookshelf struct {
+	BaseModel
+	Name string `db:"name"`
+
+	Books []EmbeddedBook `db:"books"`
+}
+
+type EmbeddedBook struct {
+	*BaseModel
+	Title string `db:"title"`
+}
+
+type RawKeyBookshelf struct {
+	ID   []byte `db:"id,pk"`
+	Name string `db:"name"`
+
+	Books []EmbeddedBook `db:"books"`
+}
+
+type RecursiveAuthor struct {
+	ID   int64  `db:"id,pk"`
+	Name string `db:"name"`
+
+	Books []RecursiveBook `db:"books,depth=2"`
+}
+
+type RecursiveBook struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+
+	Author *RecursiveAuthor `db:"author"`
+}
+
+type Category struct {
+	ID       int64  `db:"id,pk"`
+	Name     string `db:"name"`
+	ParentID *int64 `db:"parent_id"`
+
+	Children []Category `db:"children,tree=parent_id"`
+}
+
+type MistypedCategory struct {
+	ID       int32  `db:"id,pk"`
+	ParentID *int64 `db:"parent_id"`
+
+	Children []MistypedCategory `db:"children,tree=parent_id"`
+}
+
+type SharedAuthor struct {
+	ID   int64  `db:"id,pk"`
+	Name string `db:"name"`
+
+	Books []SharedBook `db:"books"`
+}
+
+type SharedBook struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+
+	Author *SharedAuthor `db:"author"`
+}
+
+// Each book's row only joins the author's books up to itself,
+// so only an identity map gives every book the author's full list
+const identityMapQuery = `SELECT
+	books.id,
+	books.title,
+	0 AS "scan:author",
+	authors.id,
+	authors.name,
+	0 AS "scan:author.books",
+	author_books.id,
+	author_books.title
+FROM books
+JOIN authors ON books.author_id = authors.id
+JOIN books author_books ON author_books.author_id = authors.id AND author_books.id <= books.id
+ORDER BY books.id ASC, author_books.id ASC`
+
+type PtrBookshelf struct {
+	ID   int64  `db:"id,pk"`
+	Name string `db:"name"`
+
+	Books []*PtrBook `db:"books"`
+}
+
+type PtrBook struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+}
+
+type MapAuthor struct {
+	ID   int64  `db:"id,pk"`
+	Name string `db:"name"`
+
+	Books map[string]MapBook `db:"books,key=title"`
+}
+
+type MapBook struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+
+	Bookshelves map[int64]*Bookshelf `db:"bookshelves"`
+}
+
+// Its books are keyed by pk, which is an int64 rather than a string
+type StringKeyedBookshelf struct {
+	ID    int64              `db:"id,pk"`
+	Books map[string]PtrBook `db:"books"`
+}
+
+type CompositeKeyedBook struct {
+	ID          int64                   `db:"id,pk"`
+	Bookshelves map[int64]BookBookshelf `db:"bookshelves"`
+}
+
+type PolyBookshelf struct {
+	ID   int64  `db:"id,pk"`
+	Name string `db:"name"`
+
+	Items []ShelfItem `db:"items"`
+}
+
+type ShelfItem interface {
+	isShelfItem()
+}
+
+type ShelfBook struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+}
+
+func (ShelfBook) isShelfItem() {}
+
+type ShelfAuthor struct {
+	ID   int64  `db:"id,pk"`
+	Name string `db:"name"`
+}
+
+func (*ShelfAuthor) isShelfItem() {}
+
+// RankedEntry's variants are chosen by an integer, so 0 is a discriminator like any other
+type RankedEntry interface {
+	isRankedEntry()
+}
+
+type FirstEntry struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+}
+
+func (FirstEntry) isRankedEntry() {}
+
+type LaterEntry struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+}
+
+func (LaterEntry) isRankedEntry() {}
+
+type RankedBookshelf struct {
+	ID      int64         `db:"id,pk"`
+	Entries []RankedEntry `db:"entries"`
+}
+
+func init() {
+	err := scansion.RegisterVariants("kind", map[string]ShelfItem{
+		"book":   ShelfBook{},
+		"author": &ShelfAuthor{},
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	err = scansion.RegisterVariants("rank", map[int64]RankedEntry{
+		0: FirstEntry{},
+		1: LaterEntry{},
+	})
+	if err != nil {
+		panic(err)
+	}
+}
+
+type Publishing struct {
+	Publisher *string `db:"publisher"`
+}
+
+type Place struct {
+	Name    string `db:"name"`
+	Country string `db:"country"`
+}
+
+// Inlining a struct in itself would need infinitely many columns
+type SelfInlineCategory struct {
+	ID     int64               `db:"id,pk"`
+	Parent *SelfInlineCategory `db:"parent,inline,prefix=parent_"`
+}
+
+type SelfEmbeddedCategory struct {
+	ID int64 `db:"id,pk"`
+	*SelfEmbeddedCategory
+}
+
+type InlineAuthor struct {
+	ID int64 `db:"id,pk"`
+	*Publishing
+
+	Hometown *Place `db:"hometown,inline,prefix=hometown_"`
+}
+
+type TableAuthor struct {
+	ID    int64       `db:"id,pk"`
+	Name  string      `db:"name"`
+	Books []TableBook `db:"books,table=books"`
+}
+
+type TableBook struct {
+	ID    int64  `db:"id,pk"`
+	Title string `db:"title"`
+}
+
+func init() {
+	scansion.RegisterTable[TableAuthor]("authors")
+}
+
+var tableSegmentsQuery = `SELECT authors.id, authors.name, books.id, books.title
+	FROM authors
+	JOIN books ON books.author_id = authors.id
+	ORDER BY authors.id ASC, books.id ASC`
+
+type RestAuthor struct {
+	ID    int64          `db:"id,pk"`
+	Extra map[string]any `db:",rest"`
+
+	Books []RestBook `db:"books"`
+}
+
+type RestBook struct {
+	ID    int64          `db:"id,pk"`
+	Extra map[string]any `db:",rest"`
+}
+
+type RestBookshelf struct {
+	ID    int64          `db:"id,pk"`
+	Name  string         `db:"name"`
+	Extra map[string]any `db:",rest"`
+
+	Books []PtrBook `db:"books"`
+}
+
+type MistypedBookshelf struct {
+	ID   int64 `db:"id,pk"`
+	Name int64 `db:"name"`
+}
+
+// rowLimitContext is cancelled once limit rows have been read,
+// since the scanners check the context before reading each row
+type rowLimitContext struct {
+	context.Context
+	limit int
+}
+
+func (c *rowLimitContext) Err() error {
+	if c.limit == 0 {
+		return context.Canceled
+	}
+	c.limit--
+	return nil
+}
+
 var setupQueries = []string{
 	`CREATE TYPE money_type AS (
 		number NUMERIC,
@@ -147,6 +444,11 @@ var setupQueries = []string{
 		book_id BIGINT NOT NULL REFERENCES books (id),
 		bookshelf_id BIGINT NOT NULL REFERENCES bookshelves (id)
 	)`,
+	`CREATE TABLE categories (
+		id BIGINT PRIMARY KEY,
+		name TEXT NOT NULL,
+		parent_id BIGINT REFERENCES categories (id)
+	)`,
 	`INSERT INTO cities (id, name, country) VALUES
 	(1, 'Dublin', 'Ireland')`,
 	`INSERT INTO websites (id, url) VALUES (1, 'https://nealstephenson.com/')`,
@@ -158,6 +460,19 @@ var setupQueries = []string{
 	(2, 1, 'Snow Crash', '(20.00,USD)'), (3, 2, 'Ulysses', '(25.00,GBP)')`,
 	`INSERT INTO bookshelves (id, name) VALUES (1, 'Daniel'), (2, 'George')`,
 	`INSERT INTO books_bookshelves (book_id, bookshelf_id) VALUES (1, 1), (2, 1), (3, 1), (3, 2)`,
+	`INSERT INTO categories (id, name, parent_id)
+	VALUES (1, 'Fiction', NULL), (2, 'Science Fiction', 1), (3, 'Cyberpunk', 2),
+	(4, 'Classics', 1), (5, 'Non-fiction', NULL)`,
+}
+
+func getTestCase(name string) testCase {
+	for _, tc := range testCases {
+		if tc.name == name {
+			return tc
+		}
+	}
+
+	panic("unknown test case " + name)
 }
 
 func toPtr[T any](val T) *T {
@@ -169,12 +484,15 @@ func getCreatedAt() time.Time {
 	return createdAt.In(time.Local)
 }
 
-var testCases = []struct {
+type testCase struct {
 	name       string
 	query      string
 	targetType reflect.Type
 	expected   any
-}{
+	options    []scansion.Option
+}
+
+var testCases = []testCase{
 	{
 		name: "single_root_row",
 		query: `SELECT
@@ -531,4 +849,758 @@ var testCases = []struct {
 			},
 		},
 	},
+	{
+		name: "composite_pk",
+		query: `SELECT bbs.*, 0 AS "scan:bookshelf", bookshelves.*
+		FROM books_bookshelves bbs
+		JOIN bookshelves ON bbs.bookshelf_id = bookshelves.id
+		ORDER BY bbs.book_id ASC, bbs.bookshelf_id ASC`,
+		targetType: reflect.TypeOf([]BookBookshelf{}),
+		expected: []BookBookshelf{
+			{BookID: 1, BookshelfID: 1, Bookshelf: Bookshelf{ID: 1, Name: "Daniel"}},
+			{BookID: 2, BookshelfID: 1, Bookshelf: Bookshelf{ID: 1, Name: "Daniel"}},
+			{BookID: 3, BookshelfID: 1, Bookshelf: Bookshelf{ID: 1, Name: "Daniel"}},
+			{BookID: 3, BookshelfID: 2, Bookshelf: Bookshelf{ID: 2, Name: "George"}},
+		},
+	},
+	{
+		name: "keyless",
+		query: `SELECT books.title, 0 AS "scan:bookshelf", bookshelves.*
+		FROM books
+		JOIN books_bookshelves bbs ON bbs.book_id = books.id
+		JOIN bookshelves ON bbs.bookshelf_id = bookshelves.id
+		ORDER BY books.id ASC, bookshelves.id ASC`,
+		targetType: reflect.TypeOf([]BookshelfEntry{}),
+		expected: []BookshelfEntry{
+			{Title: "Cryptonomicon", Bookshelf: Bookshelf{ID: 1, Name: "Daniel"}},
+			{Title: "Snow Crash", Bookshelf: Bookshelf{ID: 1, Name: "Daniel"}},
+			{Title: "Ulysses", Bookshelf: Bookshelf{ID: 1, Name: "Daniel"}},
+			{Title: "Ulysses", Bookshelf: Bookshelf{ID: 2, Name: "George"}},
+		},
+	},
+	{
+		name: "pointer_roots_with_zero_values",
+		query: `SELECT 0::bigint AS id, '' AS name
+		UNION ALL SELECT id, name FROM bookshelves WHERE id = 1`,
+		targetType: reflect.TypeOf([]*Bookshelf{}),
+		expected: []*Bookshelf{
+			{},
+			{ID: 1, Name: "Daniel"},
+		},
+	},
+	{
+		name: "keyless_pointer_roots_with_zero_values",
+		query: `SELECT '' AS title, 0 AS "scan:bookshelf", 0::bigint AS id, '' AS name
+		UNION ALL SELECT 'Ulysses', 0, 2, 'George'`,
+		targetType: reflect.TypeOf([]*BookshelfEntry{}),
+		expected: []*BookshelfEntry{
+			{},
+			{Title: "Ulysses", Bookshelf: Bookshelf{ID: 2, Name: "George"}},
+		},
+	},
+	{
+		name: "embedded_pk",
+		query: `SELECT bookshelves.*, 0 AS "scan:books", books.id, books.title
+		FROM bookshelves
+		JOIN books_bookshelves bbs ON bbs.bookshelf_id = bookshelves.id
+		JOIN books ON bbs.book_id = books.id
+		ORDER BY bookshelves.id ASC, books.id ASC`,
+		targetType: reflect.TypeOf([]EmbeddedBookshelf{}),
+		expected: []EmbeddedBookshelf{
+			{
+				BaseModel: BaseModel{ID: 1},
+				Name:      "Daniel",
+				Books: []EmbeddedBook{
+					{BaseModel: &BaseModel{ID: 1}, Title: "Cryptonomicon"},
+					{BaseModel: &BaseModel{ID: 2}, Title: "Snow Crash"},
+					{BaseModel: &BaseModel{ID: 3}, Title: "Ulysses"},
+				},
+			},
+			{
+				BaseModel: BaseModel{ID: 2},
+				Name:      "George",
+				Books: []EmbeddedBook{
+					{BaseModel: &BaseModel{ID: 3}, Title: "Ulysses"},
+				},
+			},
+		},
+	},
+	{
+		name: "bytea_pk",
+		query: `SELECT int8send(bookshelves.id) AS id, bookshelves.name, 0 AS "scan:books", books.id, books.title
+		FROM bookshelves
+		JOIN books_bookshelves bbs ON bbs.bookshelf_id = bookshelves.id
+		JOIN books ON bbs.book_id = books.id
+		ORDER BY bookshelves.id ASC, books.id ASC`,
+		targetType: reflect.TypeOf([]RawKeyBookshelf{}),
+		expected: []RawKeyBookshelf{
+			{
+				ID:   []byte{0, 0, 0, 0, 0, 0, 0, 1},
+				Name: "Daniel",
+				Books: []EmbeddedBook{
+					{BaseModel: &BaseModel{ID: 1}, Title: "Cryptonomicon"},
+					{BaseModel: &BaseModel{ID: 2}, Title: "Snow Crash"},
+					{BaseModel: &BaseModel{ID: 3}, Title: "Ulysses"},
+				},
+			},
+			{
+				ID:   []byte{0, 0, 0, 0, 0, 0, 0, 2},
+				Name: "George",
+				Books: []EmbeddedBook{
+					{BaseModel: &BaseModel{ID: 3}, Title: "Ulysses"},
+				},
+			},
+		},
+	},
+	{
+		name: "bounded_recursion",
+		query: `SELECT
+			authors.id,
+			authors.name,
+			0 AS "scan:books",
+			books.id,
+			books.title,
+			0 AS "scan:books.author",
+			book_authors.id,
+			book_authors.name,
+			0 AS "scan:books.author.books",
+			author_books.id,
+			author_books.title
+		FROM authors
+		JOIN books ON books.author_id = authors.id
+		JOIN authors book_authors ON books.author_id = book_authors.id
+		JOIN books author_books ON author_books.author_id = book_authors.id
+		ORDER BY authors.id ASC, books.id ASC, author_books.id ASC`,
+		targetType: reflect.TypeOf([]RecursiveAuthor{}),
+		expected: []RecursiveAuthor{
+			{
+				ID:   1,
+				Name: "Neal Stephenson",
+				Books: []RecursiveBook{
+					{
+						ID:    1,
+						Title: "Cryptonomicon",
+						Author: &RecursiveAuthor{
+							ID:    1,
+							Name:  "Neal Stephenson",
+							Books: []RecursiveBook{{ID: 1, Title: "Cryptonomicon"}, {ID: 2, Title: "Snow Crash"}},
+						},
+					},
+					{
+						ID:    2,
+						Title: "Snow Crash",
+						Author: &RecursiveAuthor{
+							ID:    1,
+							Name:  "Neal Stephenson",
+							Books: []RecursiveBook{{ID: 1, Title: "Cryptonomicon"}, {ID: 2, Title: "Snow Crash"}},
+						},
+					},
+				},
+			},
+			{
+				ID:   2,
+				Name: "James Joyce",
+				Books: []RecursiveBook{
+					{
+						ID:    3,
+						Title: "Ulysses",
+						Author: &RecursiveAuthor{
+							ID:    2,
+							Name:  "James Joyce",
+							Books: []RecursiveBook{{ID: 3, Title: "Ulysses"}},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name: "tree",
+		query: `SELECT
+			categories.id,
+			categories.name,
+			categories.parent_id
+		FROM categories
+		ORDER BY categories.id DESC`,
+		targetType: reflect.TypeOf([]Category{}),
+		expected: []Category{
+			{
+				ID:   5,
+				Name: "Non-fiction",
+			},
+			{
+				ID:   1,
+				Name: "Fiction",
+				Children: []Category{
+					{
+						ID:       4,
+						Name:     "Classics",
+						ParentID: toPtr(int64(1)),
+					},
+					{
+						ID:       2,
+						Name:     "Science Fiction",
+						ParentID: toPtr(int64(1)),
+						Children: []Category{
+							{
+								ID:       3,
+								Name:     "Cyberpunk",
+								ParentID: toPtr(int64(2)),
+							},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name: "pointer_slices",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			0 AS "scan:books",
+			books.id,
+			books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		ORDER BY bookshelves.id ASC, books.id ASC`,
+		targetType: reflect.TypeOf([]*PtrBookshelf{}),
+		expected: []*PtrBookshelf{
+			{
+				ID:   1,
+				Name: "Daniel",
+				Books: []*PtrBook{
+					{ID: 1, Title: "Cryptonomicon"},
+					{ID: 2, Title: "Snow Crash"},
+					{ID: 3, Title: "Ulysses"},
+				},
+			},
+			{
+				ID:    2,
+				Name:  "George",
+				Books: []*PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name: "interleaved_roots",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			0 AS "scan:books",
+			books.id,
+			books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		ORDER BY books.id DESC, bookshelves.id ASC`,
+		targetType: reflect.TypeOf([]*PtrBookshelf{}),
+		expected: []*PtrBookshelf{
+			{
+				ID:   1,
+				Name: "Daniel",
+				Books: []*PtrBook{
+					{ID: 3, Title: "Ulysses"},
+					{ID: 2, Title: "Snow Crash"},
+					{ID: 1, Title: "Cryptonomicon"},
+				},
+			},
+			{
+				ID:    2,
+				Name:  "George",
+				Books: []*PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name: "map_relations",
+		query: `SELECT
+			authors.id,
+			authors.name,
+			0 AS "scan:books",
+			books.id,
+			books.title,
+			0 AS "scan:books.bookshelves",
+			bookshelves.*
+		FROM authors
+		JOIN books ON books.author_id = authors.id
+		JOIN books_bookshelves ON books_bookshelves.book_id = books.id
+		JOIN bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id`,
+		targetType: reflect.TypeOf(map[int64]MapAuthor{}),
+		expected: map[int64]MapAuthor{
+			1: {
+				ID:   1,
+				Name: "Neal Stephenson",
+				Books: map[string]MapBook{
+					"Cryptonomicon": {
+						ID:          1,
+						Title:       "Cryptonomicon",
+						Bookshelves: map[int64]*Bookshelf{1: {ID: 1, Name: "Daniel"}},
+					},
+					"Snow Crash": {
+						ID:          2,
+						Title:       "Snow Crash",
+						Bookshelves: map[int64]*Bookshelf{1: {ID: 1, Name: "Daniel"}},
+					},
+				},
+			},
+			2: {
+				ID:   2,
+				Name: "James Joyce",
+				Books: map[string]MapBook{
+					"Ulysses": {
+						ID:    3,
+						Title: "Ulysses",
+						Bookshelves: map[int64]*Bookshelf{
+							1: {ID: 1, Name: "Daniel"},
+							2: {ID: 2, Name: "George"},
+						},
+					},
+				},
+			},
+		},
+	},
+	{
+		name: "polymorphic",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			0 AS "scan:items",
+			items.kind,
+			items.id,
+			items.title,
+			items.name
+		FROM bookshelves
+		JOIN (
+			SELECT bbs.bookshelf_id, 'book' AS kind, books.id, books.title, NULL AS name
+			FROM books_bookshelves bbs
+			JOIN books ON books.id = bbs.book_id
+			UNION ALL
+			SELECT DISTINCT bbs.bookshelf_id, 'author', authors.id, NULL, authors.name
+			FROM books_bookshelves bbs
+			JOIN books ON books.id = bbs.book_id
+			JOIN authors ON authors.id = books.author_id
+		) items ON items.bookshelf_id = bookshelves.id
+		ORDER BY bookshelves.id ASC, items.kind DESC, items.id ASC`,
+		targetType: reflect.TypeOf([]PolyBookshelf{}),
+		expected: []PolyBookshelf{
+			{
+				ID:   1,
+				Name: "Daniel",
+				Items: []ShelfItem{
+					ShelfBook{ID: 1, Title: "Cryptonomicon"},
+					ShelfBook{ID: 2, Title: "Snow Crash"},
+					ShelfBook{ID: 3, Title: "Ulysses"},
+					&ShelfAuthor{ID: 1, Name: "Neal Stephenson"},
+					&ShelfAuthor{ID: 2, Name: "James Joyce"},
+				},
+			},
+			{
+				ID:   2,
+				Name: "George",
+				Items: []ShelfItem{
+					ShelfBook{ID: 3, Title: "Ulysses"},
+					&ShelfAuthor{ID: 2, Name: "James Joyce"},
+				},
+			},
+		},
+	},
+	{
+		name: "polymorphic_zero_discriminator",
+		query: `SELECT
+			bookshelves.id,
+			0 AS "scan:entries",
+			CASE WHEN books.id = 1 THEN 0 ELSE 1 END AS rank,
+			books.id,
+			books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books.id = books_bookshelves.book_id
+		WHERE bookshelves.id = 1
+		ORDER BY books.id ASC`,
+		targetType: reflect.TypeOf([]RankedBookshelf{}),
+		expected: []RankedBookshelf{
+			{
+				ID: 1,
+				Entries: []RankedEntry{
+					FirstEntry{ID: 1, Title: "Cryptonomicon"},
+					LaterEntry{ID: 2, Title: "Snow Crash"},
+					LaterEntry{ID: 3, Title: "Ulysses"},
+				},
+			},
+		},
+	},
+	{
+		name: "embedded_pointer_inline",
+		query: `SELECT
+			authors.id,
+			authors.publisher,
+			cities.name AS hometown_name,
+			cities.country AS hometown_country
+		FROM authors
+		LEFT JOIN cities ON authors.hometown_id = cities.id
+		ORDER BY authors.id ASC`,
+		targetType: reflect.TypeOf([]InlineAuthor{}),
+		expected: []InlineAuthor{
+			{
+				ID:         1,
+				Publishing: &Publishing{Publisher: toPtr("HarperCollins")},
+			},
+			{
+				ID:       2,
+				Hometown: &Place{Name: "Dublin", Country: "Ireland"},
+			},
+		},
+	},
+	{
+		name: "column_paths",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			books.id AS "books.id",
+			books.title AS "books.title"
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		ORDER BY bookshelves.id ASC, books.id ASC`,
+		targetType: reflect.TypeOf([]*PtrBookshelf{}),
+		options:    []scansion.Option{scansion.WithPathSeparator(".")},
+		expected: []*PtrBookshelf{
+			{
+				ID:   1,
+				Name: "Daniel",
+				Books: []*PtrBook{
+					{ID: 1, Title: "Cryptonomicon"},
+					{ID: 2, Title: "Snow Crash"},
+					{ID: 3, Title: "Ulysses"},
+				},
+			},
+			{
+				ID:    2,
+				Name:  "George",
+				Books: []*PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name: "scan_prefix",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			0 AS "segment:books",
+			books.id,
+			books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		WHERE bookshelves.id = 2`,
+		targetType: reflect.TypeOf([]*PtrBookshelf{}),
+		options:    []scansion.Option{scansion.WithScanPrefix("segment:")},
+		expected: []*PtrBookshelf{
+			{
+				ID:    2,
+				Name:  "George",
+				Books: []*PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name: "segment_navigation",
+		query: `SELECT
+			authors.id,
+			0 AS "scan:books",
+			books.id,
+			books.title,
+			0 AS "scan:books.bookshelves",
+			bookshelves.id,
+			bookshelves.name,
+			0 AS "scan:^",
+			books.author_id,
+			books.price,
+			0 AS "scan:^.hometown",
+			cities.*,
+			0 AS "scan:",
+			authors.name,
+			authors.pseudonyms,
+			authors.hometown_id,
+			authors.created_at
+		FROM authors
+		JOIN books ON books.author_id = authors.id
+		JOIN books_bookshelves ON books_bookshelves.book_id = books.id
+		JOIN bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		LEFT JOIN cities ON authors.hometown_id = cities.id
+		WHERE authors.id = 2
+		ORDER BY bookshelves.id ASC`,
+		targetType: reflect.TypeOf([]Author{}),
+		expected: []Author{
+			{
+				ID:         2,
+				Name:       "James Joyce",
+				Pseudonyms: []string{"Jamie J", "JJ"},
+				HometownID: toPtr(int64(1)),
+				Hometown: &City{
+					ID:      1,
+					Name:    "Dublin",
+					Country: "Ireland",
+				},
+				Books: []Book{
+					{
+						ID:       3,
+						AuthorID: 2,
+						Title:    "Ulysses",
+						Price: MoneyType{
+							Number:   "25.00",
+							Currency: "GBP",
+						},
+						Bookshelves: []Bookshelf{
+							{ID: 1, Name: "Daniel"},
+							{ID: 2, Name: "George"},
+						},
+					},
+				},
+				Timestamps: Timestamps{
+					CreatedAt: getCreatedAt(),
+				},
+			},
+		},
+	},
+	{
+		name: "ignore_unknown_columns",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			1 AS shelf_count,
+			0 AS "scan:books",
+			books.id,
+			books.title,
+			books.price
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		WHERE bookshelves.id = 2`,
+		targetType: reflect.TypeOf([]*PtrBookshelf{}),
+		options:    []scansion.Option{scansion.WithUnknownColumns(scansion.UnknownColumnsIgnore)},
+		expected: []*PtrBookshelf{
+			{
+				ID:    2,
+				Name:  "George",
+				Books: []*PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name: "ignore_unknown_nested_columns",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			0 AS "scan:books",
+			books.id,
+			books.author_id,
+			books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		WHERE bookshelves.id = 2`,
+		targetType: reflect.TypeOf([]*PtrBookshelf{}),
+		options:    []scansion.Option{scansion.WithUnknownColumns(scansion.UnknownColumnsIgnore)},
+		expected: []*PtrBookshelf{
+			{
+				ID:    2,
+				Name:  "George",
+				Books: []*PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name: "rest_unknown_columns",
+		query: `SELECT
+			bookshelves.id,
+			bookshelves.name,
+			1::bigint AS shelf_count,
+			0 AS "scan:books",
+			books.id,
+			books.author_id,
+			books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id
+		WHERE bookshelves.id = 2`,
+		targetType: reflect.TypeOf([]RestBookshelf{}),
+		options:    []scansion.Option{scansion.WithUnknownColumns(scansion.UnknownColumnsRest)},
+		expected: []RestBookshelf{
+			{
+				ID:    2,
+				Name:  "George",
+				Extra: map[string]any{"shelf_count": int64(1), "books.author_id": int64(2)},
+				Books: []PtrBook{{ID: 3, Title: "Ulysses"}},
+			},
+		},
+	},
+	{
+		name:       "rest_fields_null_root",
+		query:      `SELECT id, publisher FROM authors WHERE id = 2`,
+		targetType: reflect.TypeOf([]RestAuthor{}),
+		expected: []RestAuthor{
+			{ID: 2, Extra: map[string]any{"publisher": nil}},
+		},
+	},
+	{
+		name: "rest_fields",
+		query: `SELECT
+			authors.id,
+			authors.name,
+			authors.publisher,
+			0 AS "scan:books",
+			books.id,
+			books.title
+		FROM authors
+		JOIN books ON books.author_id = authors.id
+		WHERE authors.id = 2`,
+		targetType: reflect.TypeOf([]RestAuthor{}),
+		expected: []RestAuthor{
+			{
+				ID:    2,
+				Extra: map[string]any{"name": "James Joyce", "publisher": nil},
+				Books: []RestBook{
+					{ID: 3, Extra: map[string]any{"title": "Ulysses"}},
+				},
+			},
+		},
+	},
+}
+
+var errorTestCases = []struct {
+	name        string
+	query       string
+	targetType  reflect.Type
+	options     []scansion.Option
+	expectedErr string
+}{
+	{
+		name:        "missing_root_pk",
+		query:       `SELECT name FROM bookshelves`,
+		targetType:  reflect.TypeOf([]Bookshelf{}),
+		expectedErr: "no primary key: root segment is missing pk column id",
+	},
+	{
+		name:        "missing_struct_root_pk",
+		query:       `SELECT name FROM bookshelves`,
+		targetType:  reflect.TypeOf(Bookshelf{}),
+		expectedErr: "no primary key: root segment is missing pk column id",
+	},
+	{
+		name: "missing_map_key_column",
+		query: `SELECT authors.id, authors.name, 0 AS "scan:books", books.id
+		FROM authors
+		JOIN books ON books.author_id = authors.id`,
+		targetType:  reflect.TypeOf([]MapAuthor{}),
+		expectedErr: "no primary key: segment books is missing key column title",
+	},
+	{
+		name:        "tree_parent_type_mismatch",
+		query:       `SELECT id, parent_id FROM categories`,
+		targetType:  reflect.TypeOf([]MistypedCategory{}),
+		expectedErr: "invalid db tag: tree of scansion_test.MistypedCategory has a pk of type int32, but column parent_id of type int64",
+	},
+	{
+		name: "missing_nested_pk",
+		query: `SELECT authors.*, 0 AS "scan:books", books.title
+		FROM authors
+		JOIN books ON books.author_id = authors.id`,
+		targetType:  reflect.TypeOf([]Author{}),
+		expectedErr: "no primary key: segment books is missing pk column id",
+	},
+	{
+		name:        "scan_column_above_root",
+		query:       `SELECT authors.id, 0 AS "scan:^", authors.name FROM authors`,
+		targetType:  reflect.TypeOf([]Author{}),
+		expectedErr: `column 1 "scan:^": malformed column name: moves above the root segment`,
+	},
+	{
+		name: "malformed_scan_column",
+		query: `SELECT books.id, 0 AS "scan:authors..website", websites.*
+		FROM books
+		JOIN authors ON books.author_id = authors.id
+		JOIN websites ON authors.website_id = websites.id`,
+		targetType:  reflect.TypeOf([]Book{}),
+		expectedErr: `column 1 "scan:authors..website": malformed column name: path has an empty segment`,
+	},
+	{
+		name:        "missing_embedded_composite_pk",
+		query:       `SELECT * FROM (VALUES (1, 'a')) AS t (id, name)`,
+		targetType:  reflect.TypeOf([]Tenant{}),
+		expectedErr: "no primary key: root segment is missing pk column tenant_id",
+	},
+	{
+		name:        "embedded_composite_pk_too_many_rows",
+		query:       `SELECT * FROM (VALUES (1, 1, 'a'), (2, 1, 'b')) AS t (tenant_id, id, name)`,
+		targetType:  reflect.TypeOf(Tenant{}),
+		expectedErr: "too many rows in result set",
+	},
+	{
+		name: "map_key_type_mismatch",
+		query: `SELECT bookshelves.id, 0 AS "scan:books", books.id, books.title
+		FROM bookshelves
+		JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id
+		JOIN books ON books_bookshelves.book_id = books.id`,
+		targetType:  reflect.TypeOf([]StringKeyedBookshelf{}),
+		expectedErr: "invalid db tag: key of type int64 can't be used as a key of map[string]scansion_test.PtrBook",
+	},
+	{
+		name:        "map_composite_pk",
+		query:       `SELECT id FROM books`,
+		targetType:  reflect.TypeOf([]CompositeKeyedBook{}),
+		expectedErr: "invalid db tag: map of scansion_test.BookBookshelf can't be keyed by a composite pk",
+	},
+	{
+		name:        "self_inline",
+		query:       `SELECT id FROM categories`,
+		targetType:  reflect.TypeOf([]SelfInlineCategory{}),
+		expectedErr: "invalid db tag: field Parent of scansion_test.SelfInlineCategory contains scansion_test.SelfInlineCategory within itself",
+	},
+	{
+		name:        "self_embedded",
+		query:       `SELECT id FROM categories`,
+		targetType:  reflect.TypeOf([]SelfEmbeddedCategory{}),
+		expectedErr: "invalid db tag: field SelfEmbeddedCategory of scansion_test.SelfEmbeddedCategory contains scansion_test.SelfEmbeddedCategory within itself",
+	},
+	{
+		name:        "interface_root",
+		query:       `SELECT id, title FROM books`,
+		targetType:  reflect.TypeOf([]ShelfItem{}),
+		expectedErr: "invalid scan target: *[]scansion_test.ShelfItem has interface elements, which are only supported in relations",
+	},
+	{
+		name:        "non_struct_elements",
+		query:       `SELECT id FROM books`,
+		targetType:  reflect.TypeOf([]int{}),
+		expectedErr: "invalid scan target: elements of *[]int are not structs or struct pointers",
+	},
+	{
+		name:        "unknown_column",
+		query:       `SELECT id, name, 1 AS shelf_count FROM bookshelves`,
+		targetType:  reflect.TypeOf([]PtrBookshelf{}),
+		expectedErr: `column 2 "shelf_count", field shelf_count: unknown column`,
+	},
+	{
+		name:        "rest_unknown_column_without_rest_field",
+		query:       `SELECT id, name, 1 AS shelf_count FROM bookshelves`,
+		targetType:  reflect.TypeOf([]PtrBookshelf{}),
+		options:     []scansion.Option{scansion.WithUnknownColumns(scansion.UnknownColumnsRest)},
+		expectedErr: `column 2 "shelf_count", field shelf_count: unknown column`,
+	},
+	{
+		name:        "unknown_column_suggestion",
+		query:       `SELECT id, name AS nme FROM bookshelves`,
+		targetType:  reflect.TypeOf([]PtrBookshelf{}),
+		expectedErr: `column 1 "nme", field nme: unknown column, did you mean "name"?`,
+	},
+	{
+		name:        "strict_fields",
+		query:       `SELECT bookshelves.*, 0 AS "scan:books", books.id FROM bookshelves JOIN books_bookshelves ON books_bookshelves.bookshelf_id = bookshelves.id JOIN books ON books_bookshelves.book_id = books.id`,
+		targetType:  reflect.TypeOf([]PtrBookshelf{}),
+		options:     []scansion.Option{scansion.WithStrictFields()},
+		expectedErr: "fields not populated by any column: books.title",
+	},
 }
@@ -1,112 +1,133 @@
 package scansion
 
 import (
+	"context"
 	"database/sql"
-	"fmt"
+	"errors"
 	"reflect"
-	"strings"
 )
 
 // PgxScanner wraps the *sql.Rows result set in Rows
 type SqlScanner struct {
 	Rows *sql.Rows
+
+	options scanOptions
 }
 
 // NewPgxScanner takes a *sql.Rows struct and returns a SqlScanner
-func NewSqlScanner(rows *sql.Rows) *SqlScanner {
+func NewSqlScanner(rows *sql.Rows, opts ...Option) *SqlScanner {
 	return &SqlScanner{
-		Rows: rows,
+		Rows:    rows,
+		options: newScanOptions(opts),
 	}
 }
 
 // Scan maps the wrapped Rows into the provided interface.
 // Unless exactly one result is expected (e.g. LIMIT 1 is used)
-// a slice is the expected argument.
-func (s *SqlScanner) Scan(v any) (err error) {
-	var rowCount int
-
-	defer func() {
-		s.Rows.Close()
-		if err == nil && rowCount == 0 {
-			err = sql.ErrNoRows
-		}
-	}()
+// a slice is the expected argument. Scanning more than one distinct root
+// into a struct returns ErrTooManyRows.
+func (s *SqlScanner) Scan(v any) error {
+	return scan(context.Background(), s, v)
+}
 
-	for s.Rows.Next() {
-		fieldMap, err := getFieldMap(v)
-		if err != nil {
-			return err
-		}
+// ScanContext is like Scan, but stops once ctx is done, closing the Rows.
+// The error then wraps ctx.Err(), and says how many rows were read.
+func (s *SqlScanner) ScanContext(ctx context.Context, v any) error {
+	return scan(ctx, s, v)
+}
 
-		if err = s.scanRow(fieldMap); err != nil {
-			return err
-		}
+func (s *SqlScanner) scanOptions() *scanOptions {
+	return &s.options
+}
 
-		if err = buildResult(v, fieldMap); err != nil {
-			return err
-		}
-		rowCount++
-	}
+func (s *SqlScanner) nextRow() bool {
+	return s.Rows.Next()
+}
 
-	return nil
+func (s *SqlScanner) closeRows() {
+	s.Rows.Close()
 }
 
-func (s *SqlScanner) scanRow(fm fieldMap) error {
-	columnTypes, err := s.Rows.ColumnTypes()
-	if err != nil {
-		return err
-	}
-	targets := make([]any, len(columnTypes))
-	fields := make([]fieldMapEntry, len(columnTypes))
-	scopedNames := make([]string, len(columnTypes))
+func (s *SqlScanner) rowsErr() error {
+	return s.Rows.Err()
+}
 
-	var path []string
-	var scanColIdxs []int
-	for i, col := range columnTypes {
-		if strings.HasPrefix(col.Name(), scanPrefix) {
-			scanField := strings.TrimPrefix(col.Name(), scanPrefix)
-			path = strings.Split(scanField, ".")
+func (s *SqlScanner) errNoRows() error {
+	return sql.ErrNoRows
+}
 
-			// database/sql cannot scan into nil, so we create a placeholder for the zero columns
-			targets[i] = reflect.New(reflect.PointerTo(reflect.TypeOf(0))).Interface()
-			scanColIdxs = append(scanColIdxs, i)
+func (s *SqlScanner) columnNames() ([]string, error) {
+	return s.Rows.Columns()
+}
 
-			continue
-		}
+func (s *SqlScanner) newTargets(plan *columnPlan) []any {
+	targets := plan.newTargets()
 
-		scopedName := strings.Join(append(path, col.Name()), ".")
-		fieldEntry, ok := fm.Map[scopedName]
-		if !ok {
-			return fmt.Errorf("field %s not defined in scan target", scopedName)
+	// database/sql cannot scan into nil, so we create a placeholder for the zero columns
+	scanColTarget := reflect.New(reflect.PointerTo(reflect.TypeOf(0))).Interface()
+	for i, col := range plan.Columns {
+		if col.IsScanColumn {
+			targets[i] = scanColTarget
 		}
+	}
 
-		targetType := fieldEntry.Type
-		if fieldEntry.Optional && targetType.Kind() != reflect.Pointer {
-			targetType = reflect.PointerTo(targetType)
+	return targets
+}
+
+func (s *SqlScanner) failedColumn(targets []any, err error) (int, error, bool) {
+	// database/sql doesn't expose the column of a scan error, but the row can be scanned again,
+	// so each column is scanned on its own until the failing one is found
+	placeholders := make([]any, len(targets))
+	for i := range placeholders {
+		placeholders[i] = new(any)
+	}
+
+	for i, target := range targets {
+		placeholders[i] = target
+		columnErr := s.Rows.Scan(placeholders...)
+		placeholders[i] = new(any)
+		if columnErr != nil {
+			if unwrapped := errors.Unwrap(columnErr); unwrapped != nil {
+				columnErr = unwrapped
+			}
+			return i, columnErr, true
 		}
+	}
 
-		targets[i] = reflect.New(targetType).Interface()
-		fields[i] = fieldEntry
-		scopedNames[i] = scopedName
+	return 0, nil, false
+}
+
+func (s *SqlScanner) columnDBType(idx int) string {
+	columnTypes, err := s.Rows.ColumnTypes()
+	if err != nil || idx >= len(columnTypes) {
+		return ""
 	}
 
+	return columnTypes[idx].DatabaseTypeName()
+}
+
+func (s *SqlScanner) scanRow(plan *columnPlan, targets []any, values rowValues) error {
+	// Values are not carried over between rows
+	clear(values)
+
+	plan.resetTargets(targets)
 	if err := s.Rows.Scan(targets...); err != nil {
 		return err
 	}
 
-	// We want to preserve the nil boundaries between tables, so we unset them after scan
-	for _, scanColIdx := range scanColIdxs {
-		targets[scanColIdx] = nil
-	}
+	for idx, col := range plan.Columns {
+		if col.IsScanColumn || col.IsIgnored {
+			// We want to preserve the nil boundaries between tables, so we skip them after scan
+			continue
+		}
 
-	for idx, t := range targets {
-		if t == nil {
-			// Scan column
+		targetVal := reflect.ValueOf(targets[idx]).Elem()
+		if col.IsRest {
+			storeRestValue(values, col, targetVal)
 			continue
 		}
 
-		targetVal := reflect.ValueOf(t).Elem()
-		currentField := fields[idx]
+		currentField := col.Field
 		if currentField.Optional && targetVal.Kind() == reflect.Pointer &&
 			currentField.Type.Kind() != reflect.Pointer {
 			if targetVal.IsNil() {
@@ -115,8 +136,7 @@ func (s *SqlScanner) scanRow(fm fieldMap) error {
 			targetVal = targetVal.Elem()
 		}
 
-		currentField.ScannedValue = targetVal
-		fm.Map[scopedNames[idx]] = currentField
+		values[col.ScopedName] = targetVal
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package scansion_test
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"os"
@@ -44,7 +45,7 @@ func TestSqlScan(t *testing.T) {
 			require.NoError(t, err)
 
 			target := reflect.New(testCase.targetType).Interface()
-			err = scansion.NewSqlScanner(rows).Scan(target)
+			err = scansion.NewSqlScanner(rows, testCase.options...).Scan(target)
 			require.NoError(t, err)
 			expectedJson, err := json.MarshalIndent(testCase.expected, "", "  ")
 			require.NoError(t, err)
@@ -54,6 +55,27 @@ func TestSqlScan(t *testing.T) {
 		})
 	}
 
+	for _, testCase := range errorTestCases {
+		t.Run(testCase.name, func(t *testing.T) {
+			db, err := sql.Open("pgx", dbUrl)
+			require.NoError(t, err)
+			defer db.Close()
+
+			tx, err := db.Begin()
+			require.NoError(t, err)
+			defer tx.Rollback()
+
+			setupSqlDb(t, setupQueries, tx)
+
+			rows, err := tx.Query(testCase.query)
+			require.NoError(t, err)
+
+			target := reflect.New(testCase.targetType).Interface()
+			err = scansion.NewSqlScanner(rows, testCase.options...).Scan(target)
+			require.EqualError(t, err, testCase.expectedErr)
+		})
+	}
+
 	t.Run("no_rows", func(t *testing.T) {
 		db, err := sql.Open("pgx", dbUrl)
 		require.NoError(t, err)
@@ -72,6 +94,194 @@ func TestSqlScan(t *testing.T) {
 		err = scansion.NewSqlScanner(rows).Scan(&book)
 		require.ErrorIs(t, err, sql.ErrNoRows)
 	})
+
+	t.Run("too_many_rows", func(t *testing.T) {
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		rows, err := tx.Query("SELECT * FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+
+		var bookshelf Bookshelf
+		err = scansion.NewSqlScanner(rows).Scan(&bookshelf)
+		require.ErrorIs(t, err, scansion.ErrTooManyRows)
+	})
+
+	t.Run("select", func(t *testing.T) {
+		ctx := context.Background()
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		bookshelves, err := scansion.SelectSql[Bookshelf](ctx, tx, "SELECT * FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+		assert.Equal(t, []Bookshelf{{ID: 1, Name: "Daniel"}, {ID: 2, Name: "George"}}, bookshelves)
+
+		bookshelves, err = scansion.SelectSql[Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 3)
+		require.NoError(t, err)
+		assert.Equal(t, []Bookshelf{}, bookshelves)
+
+		bookshelf, err := scansion.GetSql[Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 2)
+		require.NoError(t, err)
+		assert.Equal(t, Bookshelf{ID: 2, Name: "George"}, bookshelf)
+
+		bookshelfPtr, err := scansion.GetSql[*Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 2)
+		require.NoError(t, err)
+		assert.Equal(t, &Bookshelf{ID: 2, Name: "George"}, bookshelfPtr)
+
+		_, err = scansion.GetSql[Bookshelf](ctx, tx, "SELECT * FROM bookshelves WHERE id = $1", 3)
+		require.ErrorIs(t, err, sql.ErrNoRows)
+	})
+
+	t.Run("iter", func(t *testing.T) {
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		testCase := getTestCase("multiple_rows")
+		rows, err := tx.Query(testCase.query)
+		require.NoError(t, err)
+
+		var authors []Author
+		for author, err := range scansion.Iter[Author](scansion.NewSqlScanner(rows)) {
+			require.NoError(t, err)
+			authors = append(authors, author)
+		}
+
+		expectedJson, err := json.MarshalIndent(testCase.expected, "", "  ")
+		require.NoError(t, err)
+		actualJson, err := json.MarshalIndent(authors, "", "  ")
+		require.NoError(t, err)
+		assert.Equal(t, string(expectedJson), string(actualJson))
+	})
+
+	t.Run("iter_unordered", func(t *testing.T) {
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		rows, err := tx.Query(`SELECT * FROM (VALUES (1, 'a', 'x'), (2, 'b', 'y'), (1, 'a', 'x')) AS t (id, name, country)`)
+		require.NoError(t, err)
+
+		var iterErr error
+		for batch, err := range scansion.IterBatches[City](scansion.NewSqlScanner(rows, scansion.WithStrictOrder()), 1) {
+			if err != nil {
+				iterErr = err
+				break
+			}
+			require.Len(t, batch, 1)
+		}
+		require.ErrorIs(t, iterErr, scansion.ErrUnorderedRows)
+	})
+
+	t.Run("scan_context", func(t *testing.T) {
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		rows, err := tx.Query("SELECT * FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		var bookshelves []Bookshelf
+		err = scansion.NewSqlScanner(rows).ScanContext(ctx, &bookshelves)
+		require.ErrorIs(t, err, context.Canceled)
+		require.EqualError(t, err, "scan stopped after 0 rows: context canceled")
+		assert.False(t, rows.Next())
+
+		rows, err = tx.Query("SELECT * FROM books ORDER BY id ASC")
+		require.NoError(t, err)
+
+		var books []Book
+		err = scansion.NewSqlScanner(rows).ScanContext(&rowLimitContext{Context: context.Background(), limit: 2}, &books)
+		require.ErrorIs(t, err, context.Canceled)
+		require.EqualError(t, err, "scan stopped after 2 rows: context canceled")
+		assert.False(t, rows.Next())
+	})
+
+	t.Run("scan_error", func(t *testing.T) {
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		rows, err := tx.Query("SELECT id, name FROM bookshelves ORDER BY id ASC")
+		require.NoError(t, err)
+
+		var bookshelves []MistypedBookshelf
+		err = scansion.NewSqlScanner(rows).Scan(&bookshelves)
+
+		var scanErr *scansion.ScanError
+		require.ErrorAs(t, err, &scanErr)
+		assert.Equal(t, 1, scanErr.Row)
+		assert.Equal(t, 1, scanErr.ColumnIndex)
+		assert.Equal(t, "name", scanErr.Column)
+		assert.Equal(t, "name", scanErr.Field)
+		assert.Equal(t, reflect.TypeOf(int64(0)), scanErr.GoType)
+		assert.Equal(t, "TEXT", scanErr.DBType)
+	})
+
+	t.Run("identity_map", func(t *testing.T) {
+		db, err := sql.Open("pgx", dbUrl)
+		require.NoError(t, err)
+		defer db.Close()
+
+		tx, err := db.Begin()
+		require.NoError(t, err)
+		defer tx.Rollback()
+
+		setupSqlDb(t, setupQueries, tx)
+
+		rows, err := tx.Query(identityMapQuery)
+		require.NoError(t, err)
+
+		var books []SharedBook
+		err = scansion.NewSqlScanner(rows, scansion.WithIdentityMap()).Scan(&books)
+		require.NoError(t, err)
+
+		require.Len(t, books, 3)
+		assert.Same(t, books[0].Author, books[1].Author)
+		assert.Equal(t, []SharedBook{{ID: 1, Title: "Cryptonomicon"}, {ID: 2, Title: "Snow Crash"}}, books[0].Author.Books)
+		assert.Equal(t, []SharedBook{{ID: 3, Title: "Ulysses"}}, books[2].Author.Books)
+	})
 }
 
 func BenchmarkSqlScan(b *testing.B) {
@@ -101,3 +311,38 @@ func BenchmarkSqlScan(b *testing.B) {
 
 	tx.Rollback()
 }
+
+func BenchmarkSqlScanNested(b *testing.B) {
+	dbUrl, ok := os.LookupEnv("DATABASE_URL")
+	if !ok {
+		dbUrl = "host=localhost user=postgres dbname=scansion_test"
+	}
+
+	db, err := sql.Open("pgx", dbUrl)
+	require.NoError(b, err)
+	defer db.Close()
+
+	type childStruct struct {
+		Value int `db:"value,pk"`
+	}
+	type testStruct struct {
+		Value    int           `db:"value,pk"`
+		Children []childStruct `db:"children"`
+	}
+
+	tx, err := db.Begin()
+	require.NoError(b, err)
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT root AS value, 0 AS "scan:children", root * 10 + child AS value
+		FROM generate_series(1, $1) AS root
+		CROSS JOIN generate_series(1, 10) AS child
+		ORDER BY root, child`, b.N)
+	require.NoError(b, err)
+
+	var numbers []testStruct
+	err = scansion.NewSqlScanner(rows).Scan(&numbers)
+	require.NoError(b, err)
+
+	tx.Rollback()
+}
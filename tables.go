@@ -0,0 +1,147 @@
+package scansion
+
+import (
+	"context"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// tableRegistry stores the table name registered for each struct type
+var tableRegistry sync.Map
+
+// RegisterTable registers the table that rows of struct type T come from,
+// for scanners created with WithTableSegments. A relation's table option takes precedence.
+// Tables should be registered before the first scan, e.g. in an init function.
+func RegisterTable[T any](table string) {
+	tableRegistry.Store(derefType(reflect.TypeFor[T]()), table)
+	// Field maps built before the registration don't know about the table
+	fieldMapCache.Clear()
+}
+
+// WithTableSegments makes a PgxScanner infer segment boundaries from the table each column comes from,
+// for the segments whose table is given by a table option or RegisterTable.
+// So a query such as "SELECT authors.*, books.* ..." needs no scan columns.
+// Columns whose table can't be told apart, such as those of a self-join,
+// or which don't come from a table, fall back to the segment set by the last scan column.
+//
+// Table names are looked up with q, which can't be the connection the rows are read from,
+// since it's busy until they're closed. A pool works well. The names are cached by the returned Option,
+// so reusing it across scans saves looking them up again.
+// database/sql doesn't expose the table of a column, so SqlScanner ignores this.
+func WithTableSegments(q PgxQuerier) Option {
+	names := &tableNames{names: make(map[uint32]string)}
+	return func(o *scanOptions) {
+		o.tableQuerier = q
+		o.tableNames = names
+	}
+}
+
+// getTables returns the table of each segment of fm which declares one,
+// either by a table option or by RegisterTable
+func getTables(fm fieldMap) map[string]string {
+	tables := make(map[string]string)
+	for scopedName, entry := range fm.Map {
+		if entry.Flat {
+			continue
+		}
+
+		if entry.Table != "" {
+			tables[scopedName] = entry.Table
+			continue
+		}
+
+		vType := derefType(entry.Type)
+		if vType.Kind() == reflect.Slice || vType.Kind() == reflect.Map {
+			vType = derefType(vType.Elem())
+		}
+		if table, ok := tableRegistry.Load(vType); ok {
+			tables[scopedName] = table.(string)
+		}
+	}
+
+	return tables
+}
+
+// tableNames caches the table names of OIDs looked up with a querier
+type tableNames struct {
+	mu    sync.Mutex
+	names map[uint32]string
+}
+
+// lookup returns the name of each table in oids, querying q for the ones not cached yet
+func (cache *tableNames) lookup(ctx context.Context, q PgxQuerier, oids []uint32) (map[uint32]string, error) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	var missing []uint32
+	for _, oid := range oids {
+		if _, ok := cache.names[oid]; !ok && oid != 0 && !slices.Contains(missing, oid) {
+			missing = append(missing, oid)
+		}
+	}
+
+	if len(missing) > 0 {
+		rows, err := q.Query(ctx, "SELECT oid, relname FROM pg_catalog.pg_class WHERE oid = ANY($1::oid[])", missing)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var oid uint32
+			var name string
+			if err := rows.Scan(&oid, &name); err != nil {
+				return nil, err
+			}
+			cache.names[oid] = name
+		}
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	names := make(map[uint32]string, len(oids))
+	for _, oid := range oids {
+		if name, ok := cache.names[oid]; ok {
+			names[oid] = name
+		}
+	}
+
+	return names, nil
+}
+
+// inferSegments returns the segment of each column which can be told from its table,
+// by column index. columnTables holds the table of each column, or "" if it has none.
+func inferSegments(fm *fieldMap, columnTables []string) map[int][]string {
+	tableSegments := make(map[string][]string)
+	for scopedName, table := range fm.tables {
+		tableSegments[table] = append(tableSegments[table], scopedName)
+	}
+
+	// A table with more than one run of columns is joined more than once.
+	// Columns without a table, such as scan columns, end a run too.
+	tableRuns := make(map[string]int)
+	var lastTable string
+	for _, table := range columnTables {
+		if table != "" && table != lastTable {
+			tableRuns[table]++
+		}
+		lastTable = table
+	}
+
+	segments := make(map[int][]string)
+	for i, table := range columnTables {
+		if table == "" || tableRuns[table] != 1 || len(tableSegments[table]) != 1 {
+			continue
+		}
+
+		segments[i] = nil
+		if scopedName := tableSegments[table][0]; scopedName != "" {
+			segments[i] = strings.Split(scopedName, ".")
+		}
+	}
+
+	return segments
+}
@@ -0,0 +1,187 @@
+package scansion
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// treeField describes a slice field of a struct's own type,
+// which is assembled into a tree after scanning, rather than scanned into
+type treeField struct {
+	// Used to store the index of the field holding the children
+	ChildrenIdx int
+	// Used to store the index path of the field holding the parent pk
+	ParentIdx    []int
+	ParentColumn string
+}
+
+func newTreeField(fm fieldMap, vType reflect.Type, path []string, idxPath []int, childrenIdx int, parentColumn string) (treeField, error) {
+	pkIdxs, ok := fm.pkFieldMap[vType]
+	if !ok || len(pkIdxs) != 1 {
+		return treeField{}, fmt.Errorf("%w: tree of %s requires exactly one pk field", ErrNoPrimaryKey, vType)
+	}
+
+	parentEntry, ok := fm.Map[strings.Join(append(path, parentColumn), ".")]
+	if !ok {
+		return treeField{}, fmt.Errorf("%w: tree of %s refers to unknown column %s", ErrInvalidTag, vType, parentColumn)
+	}
+
+	// Keys of different types never match, unless they're normalized to the same value,
+	// like those of sql.NullInt64 and int64
+	pkType, parentType := derefType(vType.FieldByIndex(pkIdxs[0]).Type), derefType(parentEntry.Type)
+	if pkType != parentType && !hasNormalizedKey(pkType) && !hasNormalizedKey(parentType) {
+		return treeField{}, fmt.Errorf("%w: tree of %s has a pk of type %s, but column %s of type %s",
+			ErrInvalidTag, vType, pkType, parentColumn, parentType)
+	}
+
+	return treeField{
+		ChildrenIdx:  childrenIdx,
+		ParentIdx:    parentEntry.StructIdx[len(idxPath):],
+		ParentColumn: parentColumn,
+	}, nil
+}
+
+// assembleTrees links the elements of every slice in v whose type has a tree field
+// under their parents, leaving only the roots in the slice
+func (f *fieldMap) assembleTrees(v reflect.Value) error {
+	return f.assembleTreesHelper(v, make(map[uintptr]bool))
+}
+
+func (f *fieldMap) assembleTreesHelper(v reflect.Value, seen map[uintptr]bool) error {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || seen[v.Pointer()] {
+			return nil
+		}
+		seen[v.Pointer()] = true
+
+		return f.assembleTreesHelper(v.Elem(), seen)
+	case reflect.Slice:
+		elemType := v.Type().Elem()
+		if elemType.Kind() == reflect.Pointer {
+			elemType = elemType.Elem()
+		}
+		if elemType.Kind() != reflect.Struct {
+			return nil
+		}
+
+		for i := range v.Len() {
+			if err := f.assembleTreesHelper(v.Index(i), seen); err != nil {
+				return err
+			}
+		}
+
+		if tree, ok := f.trees[elemType]; ok {
+			return f.assembleTree(tree, v)
+		}
+	case reflect.Map:
+		if derefType(v.Type().Elem()).Kind() != reflect.Struct {
+			return nil
+		}
+
+		// Map elements aren't addressable, so their trees are assembled on a copy
+		for _, key := range v.MapKeys() {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			elem.Set(v.MapIndex(key))
+			if err := f.assembleTreesHelper(elem, seen); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, elem)
+		}
+	case reflect.Struct:
+		if isBuiltinStruct(v.Type()) {
+			return nil
+		}
+
+		for i := range v.NumField() {
+			if field := v.Field(i); field.CanSet() {
+				if err := f.assembleTreesHelper(field, seen); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f *fieldMap) assembleTree(tree treeField, slice reflect.Value) error {
+	if slice.Len() == 0 {
+		return nil
+	}
+
+	positions := make(map[any]int, slice.Len())
+	for i := range slice.Len() {
+		pk, err := f.getPkKey(slice.Index(i))
+		if err != nil {
+			return err
+		}
+		positions[pk] = i
+	}
+
+	var roots []int
+	children := make(map[int][]int)
+	for i := range slice.Len() {
+		parentValue, err := reflect.Indirect(slice.Index(i)).FieldByIndexErr(tree.ParentIdx)
+		if err != nil {
+			// The parent pk is inside a nil embedded struct pointer
+			roots = append(roots, i)
+			continue
+		}
+
+		parentPk, err := normalizeKey(parentValue)
+		if err != nil {
+			return err
+		}
+
+		// Rows whose parent isn't in the result set are roots too
+		if parentPos, ok := positions[parentPk]; ok && parentPk != nil && parentPos != i {
+			children[parentPos] = append(children[parentPos], i)
+		} else {
+			roots = append(roots, i)
+		}
+	}
+
+	var linked int
+	var link func(pos int) reflect.Value
+	link = func(pos int) reflect.Value {
+		linked++
+		node := reflect.New(slice.Type().Elem()).Elem()
+		node.Set(slice.Index(pos))
+		if len(children[pos]) > 0 {
+			nodeStruct := node
+			if nodeStruct.Kind() == reflect.Pointer {
+				nodeStruct = nodeStruct.Elem()
+			}
+
+			nodeChildren := reflect.MakeSlice(slice.Type(), 0, len(children[pos]))
+			for _, childPos := range children[pos] {
+				nodeChildren = reflect.Append(nodeChildren, link(childPos))
+			}
+			nodeStruct.Field(tree.ChildrenIdx).Set(nodeChildren)
+		}
+		return node
+	}
+
+	result := reflect.MakeSlice(slice.Type(), 0, len(roots))
+	for _, pos := range roots {
+		result = reflect.Append(result, link(pos))
+	}
+
+	// Rows which can't be reached from a root have parents forming a cycle
+	if linked != slice.Len() {
+		return fmt.Errorf("%w: rows of %s form a cycle through %s", ErrTreeCycle, derefType(slice.Type().Elem()), tree.ParentColumn)
+	}
+
+	slice.Set(result)
+	return nil
+}
+
+// hasNormalizedKey reports whether the keys of vType come from Keyer or driver.Valuer,
+// rather than from the value itself
+func hasNormalizedKey(vType reflect.Type) bool {
+	ptrType := reflect.PointerTo(vType)
+	return vType.Implements(keyerType) || ptrType.Implements(keyerType) ||
+		vType.Implements(valuerType) || ptrType.Implements(valuerType)
+}
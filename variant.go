@@ -0,0 +1,243 @@
+package scansion
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// variantSet describes the concrete types an interface relation can hold
+type variantSet struct {
+	// Used to store the name of the column whose value chooses the concrete type
+	Column     string
+	ColumnType reflect.Type
+
+	// Used to store the concrete type registered for each discriminator key
+	Types map[any]reflect.Type
+}
+
+// variantRegistry stores a *variantSet for each interface type
+var variantRegistry sync.Map
+
+// RegisterVariants registers the concrete types that relations of interface type I can hold.
+// In each row, the value of column in the relation's segment chooses the type from variants,
+// and the rest of the segment is scanned into it. Each variant must be a struct or struct pointer,
+// and columns shared between variants must have the same Go type in each.
+// Variants should be registered before the first scan, e.g. in an init function.
+func RegisterVariants[I any, K comparable](column string, variants map[K]I) error {
+	ifaceType := reflect.TypeFor[I]()
+	if ifaceType.Kind() != reflect.Interface {
+		return fmt.Errorf("%w: %s is not an interface", ErrInvalidVariant, ifaceType)
+	}
+
+	set := &variantSet{
+		Column:     column,
+		ColumnType: reflect.TypeFor[K](),
+		Types:      make(map[any]reflect.Type, len(variants)),
+	}
+	for discriminator, variant := range variants {
+		variantType := reflect.TypeOf(variant)
+		if variantType == nil || derefType(variantType).Kind() != reflect.Struct {
+			return fmt.Errorf("%w: variant %v of %s is not a struct or struct pointer", ErrInvalidVariant, discriminator, ifaceType)
+		}
+
+		key, err := normalizeKey(reflect.ValueOf(discriminator))
+		if err != nil {
+			return err
+		}
+		set.Types[key] = variantType
+	}
+
+	variantRegistry.Store(ifaceType, set)
+	// Field maps built before the registration don't know about the variants
+	fieldMapCache.Clear()
+
+	return nil
+}
+
+// getVariants returns the variants registered for vType, if it's an interface
+func getVariants(vType reflect.Type) (*variantSet, bool) {
+	if vType.Kind() != reflect.Interface {
+		return nil, false
+	}
+
+	set, ok := variantRegistry.Load(vType)
+	if !ok {
+		return nil, false
+	}
+
+	return set.(*variantSet), true
+}
+
+// isRelationType reports whether vType is scanned as a nested segment,
+// being a struct, struct pointer, or interface with registered variants
+func isRelationType(vType reflect.Type) bool {
+	if _, ok := getVariants(vType); ok {
+		return true
+	}
+
+	return derefType(vType).Kind() == reflect.Struct
+}
+
+// getVariantsFieldMap builds the field map of each variant in set, and merges them.
+// Fields directly in the segment can have a different index in each variant,
+// so their indexes are stored in Variants.
+func getVariantsFieldMap(set *variantSet, path []string, visited []reflect.Type) (fieldMap, error) {
+	fieldMap := fieldMap{
+		Map:        make(map[string]fieldMapEntry),
+		pkFieldMap: make(map[reflect.Type][][]int),
+		pkNames:    make(map[string][]string),
+		trees:      make(map[reflect.Type]treeField),
+		variants:   make(map[string]*variantSet),
+		rest:       make(map[string]fieldMapEntry),
+	}
+
+	segmentName := strings.Join(path, ".")
+	fieldMap.variants[segmentName] = set
+
+	variantTypes := slices.Collect(maps.Values(set.Types))
+	slices.SortFunc(variantTypes, func(a, b reflect.Type) int {
+		return strings.Compare(a.String(), b.String())
+	})
+
+	for _, variantType := range variantTypes {
+		structType := derefType(variantType)
+		if slices.Contains(visited, structType) {
+			continue
+		}
+
+		nestedMap, err := getFieldMapHelper(structType, path, nil, append(visited, structType), true, "")
+		if err != nil {
+			return fieldMap, err
+		}
+
+		for scopedName, entry := range nestedMap.Map {
+			existing, ok := fieldMap.Map[scopedName]
+			if strings.Count(scopedName, ".") == len(path) {
+				// A field directly in the segment
+				if ok && existing.Type != entry.Type {
+					return fieldMap, fmt.Errorf("%w: column %s has type %s in one variant, but %s in %s", ErrInvalidVariant,
+						scopedName, existing.Type, entry.Type, structType)
+				}
+				if !ok {
+					existing = entry
+					existing.StructIdx = nil
+					existing.Variants = make(map[reflect.Type][]int)
+				}
+				existing.Variants[structType] = entry.StructIdx
+				fieldMap.Map[scopedName] = existing
+				continue
+			}
+
+			if ok && (existing.Type != entry.Type || !slices.Equal(existing.StructIdx, entry.StructIdx)) {
+				return fieldMap, fmt.Errorf("%w: field %s is defined differently by the variants of %s", ErrInvalidVariant, scopedName, segmentName)
+			}
+			fieldMap.Map[scopedName] = entry
+		}
+
+		maps.Copy(fieldMap.pkFieldMap, nestedMap.pkFieldMap)
+		maps.Copy(fieldMap.trees, nestedMap.trees)
+		maps.Copy(fieldMap.variants, nestedMap.variants)
+		for scopedName, entry := range nestedMap.rest {
+			if scopedName != segmentName {
+				fieldMap.rest[scopedName] = entry
+				continue
+			}
+
+			// Like the fields directly in the segment, each variant's rest field has its own index
+			existing, ok := fieldMap.rest[scopedName]
+			if !ok {
+				existing = entry
+				existing.StructIdx = nil
+				existing.Variants = make(map[reflect.Type][]int)
+			}
+			existing.Variants[structType] = entry.StructIdx
+			fieldMap.rest[scopedName] = existing
+		}
+		fieldMap.mergePkNames(nestedMap.pkNames)
+	}
+
+	// The discriminator doesn't need a field of its own in the variants
+	columnName := strings.Join(append(path, set.Column), ".")
+	if _, ok := fieldMap.Map[columnName]; !ok {
+		fieldMap.Map[columnName] = fieldMapEntry{
+			Type:     set.ColumnType,
+			Optional: true,
+			Variants: make(map[reflect.Type][]int),
+		}
+	}
+
+	return fieldMap, nil
+}
+
+// buildVariant builds the concrete type chosen by the discriminator in values into target,
+// which is an interface. If the discriminator is NULL, target is left nil.
+func buildVariant(fieldMap *fieldMap, values rowValues, index mergeIndex, idxPath string, path []string, target reflect.Value) error {
+	segmentName := strings.Join(path, ".")
+	set, ok := fieldMap.variants[segmentName]
+	if !ok {
+		return fmt.Errorf("%w: no variants registered for %s", ErrInvalidVariant, target.Type())
+	}
+
+	// A NULL discriminator is missing from values, or a nil pointer if its field is one.
+	// A zero discriminator is a key like any other.
+	discriminator := values[strings.Join(append(path, set.Column), ".")]
+	if !discriminator.IsValid() || (discriminator.Kind() == reflect.Pointer && discriminator.IsNil()) {
+		return nil
+	}
+
+	key, err := normalizeKey(discriminator)
+	if err != nil {
+		return err
+	}
+
+	variantType, ok := set.Types[key]
+	if !ok {
+		return fmt.Errorf("%w: no variant of %s registered for %s %v", ErrUnknownVariant, target.Type(), set.Column, key)
+	}
+
+	variant := reflect.New(variantType).Elem()
+	if variantType.Kind() == reflect.Pointer {
+		variant.Set(reflect.New(variantType.Elem()))
+	}
+
+	if err := buildHelper(fieldMap, values, index, idxPath, path, variant); err != nil {
+		return err
+	}
+
+	target.Set(variant)
+	return nil
+}
+
+// mergeVariant merges the interface value newValue into origValue,
+// returning the merged value. Concrete values held by an interface can't be modified,
+// so unlike pointers they're merged into a copy.
+func mergeVariant(fieldMap *fieldMap, index mergeIndex, idxPath string, origValue, newValue reflect.Value) (reflect.Value, error) {
+	if origValue.IsNil() {
+		return newValue, nil
+	}
+	if newValue.IsNil() || origValue.Elem().Type() != newValue.Elem().Type() {
+		return origValue, nil
+	}
+
+	origElem, newElem := origValue.Elem(), newValue.Elem()
+	if origElem.Kind() == reflect.Pointer {
+		if origElem.Pointer() == newElem.Pointer() {
+			return origValue, nil
+		}
+		return origValue, structMerge(fieldMap, index, idxPath, origElem.Elem(), newElem.Elem())
+	}
+
+	merged := reflect.New(origElem.Type()).Elem()
+	merged.Set(origElem)
+	if err := structMerge(fieldMap, index, idxPath, merged, newElem); err != nil {
+		return origValue, err
+	}
+
+	result := reflect.New(origValue.Type()).Elem()
+	result.Set(merged)
+	return result, nil
+}